@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+	"github.com/alfalfalfa/mysql_tool/util/copy"
+	"github.com/docopt/docopt-go"
+)
+
+const usageCheck = `mysql_tool check
+    テーブル定義の差分検査(差分があれば終了コード1)
+
+Usage:
+    mysql_tool check -h | --help
+    mysql_tool check --old OLD [--foreign-key] [--ignore-tables IGNORE_TABLES...] [--ignore-comment] [--ignore-column-order] [--auto-increment] [--rules RULES] [--mysql-version VERSION] INPUTS...
+
+Arg:
+    入力ファイルパス（json, yaml, xlsx, dir） | mysql dsn(https://github.com/go-sql-driver/mysql#dsn-data-source-name)
+
+Options:
+    -h --help                             Show this screen.
+    --old OLD                             比較元
+        ファイルパス
+            指定ファイル(xlsx,json)との差分を検査
+        dsn
+            指定データベースとの差分を検査
+    --foreign-key                         外部キーの差分も検査
+    --ignore-tables=IGNORE_TABLES...      無視テーブル
+    --ignore-comment                      コメントのみの差分を無視(--rulesのattributes: commentと同じ)
+    --ignore-column-order                 カラム並び順のみの差分を無視(--rulesのattributes: column_orderと同じ)
+    --auto-increment                      テーブルのAUTO_INCREMENT値(mysql dsnのみ)の差分も検査
+    --rules=RULES                         差分の無視ルール(yaml, diffと同様)
+    --mysql-version=VERSION               比較対象のMySQLバージョン(diffと同様)
+
+Exit status:
+    0  差分なし
+    1  差分あり
+    2  エラー
+`
+
+type CheckArg struct {
+	Old               string   `arg:"--old"`
+	Inputs            []string `arg:"INPUTS"`
+	ForeignKey        bool     `arg:"--foreign-key"`
+	IgnoreTables      []string `arg:"--ignore-tables"`
+	IgnoreComment     bool     `arg:"--ignore-comment"`
+	IgnoreColumnOrder bool     `arg:"--ignore-column-order"`
+	AutoIncrement     bool     `arg:"--auto-increment"`
+	Rules             string   `arg:"--rules"`
+	MysqlVersion      string   `arg:"--mysql-version"`
+}
+
+func RunCheck() {
+	arguments, err := docopt.Parse(usageCheck, os.Args[1:], true, "", false)
+	checkError(err)
+	arg := &CheckArg{}
+	copy.MapToStructWithTag(arguments, arg, "arg")
+
+	newModel := models.LoadModel(arg.IgnoreTables, arg.Inputs...)
+	oldModel := models.LoadModel(arg.IgnoreTables, arg.Old)
+	setTargetVersion(arg.MysqlVersion, oldModel)
+
+	rule := loadDiffRule(arg.Rules)
+	if arg.IgnoreComment {
+		rule.AddAttribute(ignoreAttributeComment)
+	}
+	if arg.IgnoreColumnOrder {
+		rule.AddAttribute(ignoreAttributeColumnOrder)
+	}
+	if !arg.AutoIncrement {
+		rule.AddAttribute(ignoreAttributeAutoIncrement)
+	}
+	rule.Apply(newModel, oldModel)
+
+	changes := collectSchemaChanges(newModel, oldModel, arg.ForeignKey, rule.IgnoresAttribute(ignoreAttributeColumnOrder))
+	if len(changes) == 0 {
+		fmt.Println("no diff")
+		return
+	}
+	for _, c := range changes {
+		fmt.Println(c.String())
+	}
+	fmt.Printf("%d differences\n", len(changes))
+	os.Exit(1)
+}
+
+// diffDefinesと同じ比較結果を1件ずつ表す
+type schemaChange struct {
+	Table  string
+	Object string
+	Name   string
+	Kind   string
+	Detail string
+
+	// カラムの変更のみ
+	OldColumn *models.Column
+	NewColumn *models.Column
+}
+
+// データが失われる可能性のある変更か
+func (this schemaChange) IsDestructive() bool {
+	if this.Kind == "dropped" && (this.Object == "table" || this.Object == "column") {
+		return true
+	}
+	if this.Object != "column" || this.Kind != "changed" {
+		return false
+	}
+	for _, changeType := range this.OldColumn.ChangeTypes(this.NewColumn) {
+		if changeType == models.ColumnChangeType_Type {
+			return true
+		}
+		if changeType == models.ColumnChangeType_NotNull && this.NewColumn.NotNull {
+			return true
+		}
+	}
+	return false
+}
+
+func (this schemaChange) String() string {
+	res := "table `" + this.Table + "`"
+	if this.Object != "table" {
+		res += ": " + this.Object + " `" + this.Name + "`"
+	}
+	res += " " + this.Kind
+	if this.Detail != "" {
+		res += " (" + this.Detail + ")"
+	}
+	return res
+}
+
+func collectSchemaChanges(newModel, oldModel *models.Models, foreignKey bool, ignoreColumnOrder bool) []schemaChange {
+	res := make([]schemaChange, 0)
+
+	//テーブル追加/削除
+	addTables, dropTables, remainTableNames := diffTableByName(newModel, oldModel)
+	for _, t := range addTables {
+		res = append(res, schemaChange{Table: t.Name.LowerSnake(), Object: "table", Kind: "added"})
+	}
+	for _, t := range dropTables {
+		res = append(res, schemaChange{Table: t.Name.LowerSnake(), Object: "table", Kind: "dropped"})
+	}
+
+	for _, tableName := range remainTableNames {
+		newTable := newModel.GetTable(tableName)
+		oldTable := oldModel.GetTable(tableName)
+
+		//テーブル変更
+		if oldTable.IsChange(newTable) || oldTable.IsChangeAutoIncrement(newTable) {
+			res = append(res, schemaChange{Table: tableName, Object: "table", Kind: "changed", Detail: describeTableChange(oldTable, newTable)})
+		}
+
+		//カラム追加/削除/リネーム
+		adds, drops, _, renames := diffColumnByDefine(newTable, oldTable)
+		for _, c := range adds {
+			res = append(res, schemaChange{Table: tableName, Object: "column", Name: c.Name.LowerSnake(), Kind: "added", Detail: strings.TrimSpace(c.ToCreateSQL()), NewColumn: c})
+		}
+		for _, c := range drops {
+			res = append(res, schemaChange{Table: tableName, Object: "column", Name: c.Name.LowerSnake(), Kind: "dropped", OldColumn: c})
+		}
+		for _, r := range renames {
+			res = append(res, schemaChange{Table: tableName, Object: "column", Name: r.Old.Name.LowerSnake(), Kind: "renamed", Detail: "to `" + r.New.Name.LowerSnake() + "`", OldColumn: r.Old, NewColumn: r.New})
+		}
+
+		//カラム定義変更
+		_, _, commonNames := diffColumnByName(newTable, oldTable)
+		for _, columnName := range commonNames {
+			newColumn := newTable.GetColumn(columnName)
+			oldColumn := oldTable.GetColumn(columnName)
+			changeTypes := oldColumn.ChangeTypes(newColumn)
+			if len(changeTypes) == 0 {
+				continue
+			}
+			res = append(res, schemaChange{Table: tableName, Object: "column", Name: columnName, Kind: "changed", Detail: describeColumnChange(oldColumn, newColumn, changeTypes), OldColumn: oldColumn, NewColumn: newColumn})
+		}
+
+		//カラム並び順
+		if !ignoreColumnOrder {
+			for _, moveOp := range getMoveOps(newTable, oldTable) {
+				detail := "first"
+				if moveOp.After != "" {
+					detail = "after `" + moveOp.After + "`"
+				}
+				res = append(res, schemaChange{Table: tableName, Object: "column", Name: moveOp.Column, Kind: "moved", Detail: detail, OldColumn: oldTable.GetColumn(moveOp.Column), NewColumn: newTable.GetColumn(moveOp.Column)})
+			}
+		}
+
+		//インデックス追加/削除/変更
+		indexAdds, indexDrops, modifyNames, indexRenames := diffIndexBySQL(newTable, oldTable)
+		for _, in := range indexAdds {
+			res = append(res, schemaChange{Table: tableName, Object: "index", Name: in.Name, Kind: "added", Detail: strings.TrimSpace(in.ToCreateSQL())})
+		}
+		for _, in := range indexDrops {
+			res = append(res, schemaChange{Table: tableName, Object: "index", Name: in.Name, Kind: "dropped"})
+		}
+		for _, r := range indexRenames {
+			res = append(res, schemaChange{Table: tableName, Object: "index", Name: r.Old.Name, Kind: "renamed", Detail: "to `" + r.New.Name + "`"})
+		}
+		for _, indexName := range modifyNames {
+			detail := strings.TrimSpace(oldTable.GetIndex(indexName).ToCreateSQL()) + " -> " + strings.TrimSpace(newTable.GetIndex(indexName).ToCreateSQL())
+			res = append(res, schemaChange{Table: tableName, Object: "index", Name: indexName, Kind: "changed", Detail: detail})
+		}
+
+		//Ref
+		if foreignKey {
+			refAdds, refDrops := diffRef(newTable, oldTable)
+			for _, c := range refDrops {
+				res = append(res, schemaChange{Table: tableName, Object: "foreign key", Name: c.Name.LowerSnake(), Kind: "dropped", Detail: c.Reference})
+			}
+			for _, c := range refAdds {
+				res = append(res, schemaChange{Table: tableName, Object: "foreign key", Name: c.Name.LowerSnake(), Kind: "added", Detail: c.Reference})
+			}
+		}
+	}
+	return res
+}
+
+func describeTableChange(oldTable, newTable *models.Table) string {
+	details := make([]string, 0)
+	if oldTable.Engine != newTable.Engine {
+		details = append(details, "engine: "+oldTable.Engine+" -> "+newTable.Engine)
+	}
+	if oldTable.DefaultCharset != newTable.DefaultCharset {
+		details = append(details, "charset: "+oldTable.DefaultCharset+" -> "+newTable.DefaultCharset)
+	}
+	if oldTable.Comment != newTable.Comment {
+		details = append(details, "comment: '"+oldTable.Comment+"' -> '"+newTable.Comment+"'")
+	}
+	if oldTable.IsChangeAutoIncrement(newTable) {
+		details = append(details, fmt.Sprintf("auto_increment: %d -> %d", oldTable.AutoIncrement, newTable.AutoIncrement))
+	}
+	return strings.Join(details, ", ")
+}
+
+func describeColumnChange(oldColumn, newColumn *models.Column, changeTypes []models.ColumnChangeType) string {
+	details := make([]string, 0)
+	for _, changeType := range changeTypes {
+		switch changeType {
+		case models.ColumnChangeType_Type:
+			details = append(details, "type: "+oldColumn.Type+" -> "+newColumn.Type)
+		case models.ColumnChangeType_Comment:
+			details = append(details, "comment: '"+oldColumn.Comment+"' -> '"+newColumn.Comment+"'")
+		case models.ColumnChangeType_NotNull:
+			details = append(details, fmt.Sprintf("not null: %v -> %v", oldColumn.NotNull, newColumn.NotNull))
+		case models.ColumnChangeType_Default:
+			details = append(details, "default: "+describeDefault(oldColumn)+" -> "+describeDefault(newColumn))
+		case models.ColumnChangeType_Extra:
+			details = append(details, "extra: '"+oldColumn.Extra+"' -> '"+newColumn.Extra+"'")
+		}
+	}
+	return strings.Join(details, ", ")
+}
+
+func describeDefault(c *models.Column) string {
+	if !c.Default.Valid {
+		return "NULL"
+	}
+	return "'" + c.Default.ValueOrZero() + "'"
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"io"
 	"io/ioutil"
 	"os"
 	"reflect"
@@ -16,7 +17,6 @@ import (
 
 	"github.com/alfalfalfa/mysql_tool/models"
 	"github.com/alfalfalfa/mysql_tool/util/copy"
-	jsonutil "github.com/alfalfalfa/mysql_tool/util/json"
 	"github.com/alfalfalfa/xlsx"
 	"github.com/docopt/docopt-go"
 )
@@ -26,10 +26,10 @@ const usageData = `mysql_tool data
 
 Usage:
     mysql_tool data -h | --help
-    mysql_tool data [-f FORMAT] [-o OUTPUT] [--tables TABLES...] [--ignore-tables IGNORE_TABLES...] [--defines INPUTS...] [--skip-truncate] INPUTS...
+    mysql_tool data [-f FORMAT] [-o OUTPUT] [--tables TABLES...] [--ignore-tables IGNORE_TABLES...] [--defines INPUTS...] [--skip-truncate] [--rows-per-insert ROWS] [--max-insert-bytes BYTES] [--lock-tables] [--disable-keys] [--batches-per-transaction BATCHES] [--mode MODE] [--table-mode TABLE_MODE...] [--no-header] [--null NULL] [--quote QUOTE] [--bom] [--yaml-layout LAYOUT] [--validate] [--filters FILTERS] [--where WHERE...] [--order-by ORDER_BY...] [--limit LIMIT...] [--sample SAMPLE...] [--seed SEED] INPUTS...
 
 Arg:
-    入力ファイルパス（json,xlsx） | mysql dsn(https://github.com/go-sql-driver/mysql#dsn-data-source-name)
+    入力ファイルパス（json,yaml,xlsx,csv,tsv,dir） | mysql dsn(https://github.com/go-sql-driver/mysql#dsn-data-source-name)
 
 Options:
     -h --help                             Show this screen.
@@ -38,19 +38,100 @@ Options:
             insert文を出力
         "json"
             Json出力
+        "yaml"
+            yaml出力(--yaml-layout)
         "xlsx"
             Excel出力
+        "mysql"
+            mysqlへ直接書き込み(OUTPUTはmysql dsn)
+        "csv", "tsv"
+            テーブル毎に<テーブル名>.csv, .tsvを出力(OUTPUTはディレクトリ)
+        "testfixtures"
+            go-testfixtures形式でテーブル毎に<テーブル名>.ymlを出力(OUTPUTはディレクトリ)
         none
-            OUTPUTの拡張子から自動判別 （default: sql）
+            OUTPUTの拡張子から自動判別 （default: sql、mysql dsnの場合はmysql）
     -o OUTPUT, --output=OUTPUT            出力先
         ファイルパス
             上書き
+        mysql dsn
+            プリペアドステートメントの複数行INSERTをテーブル毎のトランザクションで実行し、テーブル毎の件数を出力
         none
             標準出力（Excel出力では無効）
     --tables=TABLES...                    対象テーブル
     --ignore-tables=IGNORE_TABLES...      無視テーブル
     --skip-truncate                       テーブルの削除を実行しない
-	--defines=INPUTS...                    DB定義ファイル
+	--defines=INPUTS...                    DB定義ファイル(値をカラムの型に合わせて出力)
+    --rows-per-insert=ROWS                INSERT文1つの最大行数 [default: 0]
+        0の場合はテーブル毎に1つ(mysql出力では1000)
+    --max-insert-bytes=BYTES              INSERT文1つの最大バイト数(sql出力、max_allowed_packet未満を指定) [default: 0]
+        0の場合は無制限
+    --lock-tables                         テーブル毎にLOCK TABLES, UNLOCK TABLESで囲む(sql出力)
+    --disable-keys                        テーブル毎にALTER TABLE DISABLE KEYS, ENABLE KEYSで囲む(sql出力)
+    --batches-per-transaction=BATCHES     INSERT文N個毎にCOMMITする(sql出力ではautocommitを無効化) [default: 0]
+        0の場合はトランザクションを使用しない(mysql出力ではテーブル毎に1つ)
+    --mode=MODE                           テーブルへの書き込み方法 [default: truncate]
+        "truncate"
+            TRUNCATE + INSERT(--skip-truncateの場合はinsert)
+        "delete"
+            DELETE + INSERT(トランザクション内で削除)
+        "insert"
+            INSERTのみ
+        "upsert"
+            INSERT ... ON DUPLICATE KEY UPDATE
+        "replace"
+            REPLACE
+        "ignore"
+            INSERT IGNORE
+        "sync"
+            主キー(--defines)で突き合わせ、追加, 変更された行のみ書き込み、データにない行を削除
+            sql出力ではINSERT ... ON DUPLICATE KEY UPDATE + データにない主キーの行をDELETE(主キーを一時テーブルに書き込み結合して削除)
+            行のないテーブルは全行を削除
+            mysql出力ではテーブルの行を読み込んで差分の行のみINSERT, UPDATE, DELETE
+    --table-mode=TABLE_MODE...            テーブル毎の書き込み方法(TABLE:MODE 例: users:upsert)
+    --no-header                           csv, tsvの1行目をヘッダーとしない(入力ではカラムは--definesの定義順)
+    --null=NULL                           csv, tsvのnullの値 [default: \N]
+    --quote=QUOTE                         csv, tsv出力のクォート [default: minimal]
+        "minimal"
+            区切り文字, クォート, 改行を含む値のみ
+        "all"
+            全ての値
+        "none"
+            クォートしない(区切り文字, 改行を含む値はエラー)
+    --bom                                 csv, tsv出力の先頭にBOMを付与(ExcelでUTF-8として開く)
+    --yaml-layout=LAYOUT                  yaml出力の形式 [default: keyed]
+        "keyed"
+            テーブル名: [{カラム名: 値}]
+        "positional"
+            Tables: [{Name, Keys, Values}](jsonと同じ)
+        入力では内容から判別(testfixtures形式のファイルも可)
+    --validate                            出力前にデータを--definesで検査(data-lintと同じ、エラーがあれば出力せず終了コード1、mysqlの入力は不可)
+    --filters=FILTERS                     mysqlから読み込む行の条件ファイル(yaml、--where, --order-by, --limit, --sampleが優先)
+        テーブル名(TABLE)はglob、どのテーブルにも一致しない指定は標準エラー出力に警告
+        globよりテーブル名の指定が優先、--mode syncのテーブルには指定不可(読み込まない行が削除されるため)
+    --where=WHERE...                      mysqlから読み込む行の条件(TABLE:WHERE句の条件)
+    --order-by=ORDER_BY...                mysqlから読み込む行の順序(TABLE:ORDER BY句)
+    --limit=LIMIT...                      mysqlから読み込む最大行数(TABLE:行数 or 行数(全テーブル))
+        順序の指定(--order-by)がない場合は主キー順
+    --sample=SAMPLE...                    mysqlから読み込む行のサンプリング(TABLE:値 or 値(全テーブル))
+        "10%"
+            各行を10%の確率で選ぶ(WHERE RAND() < 0.1)
+        "100"
+            ランダムに100行(ORDER BY RAND() LIMIT 100)
+    --seed=SEED                           --sampleの乱数のシード(RAND(SEED))
+
+Values:
+    "null"(大文字小文字を区別しない)はNULL、文字列"null"は"\null"と書く(\を重ねた場合は\を1つ除く)
+    json, xlsx以外の出力ではnullはnull(csv, tsvは--null)、文字列"null"は"null"(csv, tsvの--nullと同じ文字列は前に"\"を付ける)
+    --definesのカラムの値
+        数値, bool(true/falseは1/0), bitはクォートしない、binary, blobは16進数(X'...')
+        date, datetime, timestamp, timeは正規化(2006/1/2, Excelのシリアル値なども可)
+        空の値はデフォルト値(NULLはnull、CURRENT_TIMESTAMPなどの式はそのまま、mysqlへの出力ではテーブル毎に1回評価)
+
+Export:
+    mysqlからの出力はテーブルを全件読み込まず1行ずつ出力する(メモリ使用量は行数に依存しない)
+    mysqlの文字列は他の入力と同じ値として扱う(エスケープ、文字列"null"は"\null")
+    進捗(テーブル毎の出力行数/概算行数)は標準エラー出力
+    データのないテーブルは出力しない(--mode syncは全行を削除するため出力)
 `
 
 type DataArg struct {
@@ -61,6 +142,31 @@ type DataArg struct {
 	IgnoreTables []string `arg:"--ignore-tables"`
 	SkipTruncate bool     `arg:"--skip-truncate"`
 	Defines      []string `arg:"--defines"`
+
+	RowsPerInsert         int  `arg:"--rows-per-insert"`
+	MaxInsertBytes        int  `arg:"--max-insert-bytes"`
+	LockTables            bool `arg:"--lock-tables"`
+	DisableKeys           bool `arg:"--disable-keys"`
+	BatchesPerTransaction int  `arg:"--batches-per-transaction"`
+
+	Mode       string   `arg:"--mode"`
+	TableModes []string `arg:"--table-mode"`
+
+	NoHeader bool   `arg:"--no-header"`
+	Null     string `arg:"--null"`
+	Quote    string `arg:"--quote"`
+	Bom      bool   `arg:"--bom"`
+
+	YamlLayout string `arg:"--yaml-layout"`
+
+	Validate bool `arg:"--validate"`
+
+	Filters  string   `arg:"--filters"`
+	Wheres   []string `arg:"--where"`
+	OrderBys []string `arg:"--order-by"`
+	Limits   []string `arg:"--limit"`
+	Samples  []string `arg:"--sample"`
+	Seed     string   `arg:"--seed"`
 }
 
 func RunData() {
@@ -71,45 +177,99 @@ func RunData() {
 	copy.MapToStructWithTag(arguments, arg, "arg")
 	//fmt.Println(json.ToJson(arg))
 
-	d := loadData(arg)
+	if detectDataInputFormat(arg.Inputs[0]) != "mysql" && (!loadDataFilter(arg).IsEmpty() || arg.Seed != "") {
+		panic("--filters, --where, --order-by, --limit, --sample, --seed require mysql input")
+	}
 
-	format := detectOutputFormat(arg.Format, arg.Output)
-	b := marshalData(d, format, arg)
+	format := detectDataOutputFormat(arg)
+	if arg.Output == "" && (format == "xlsx" || format == "mysql") {
+		panic(format + " stdout")
+	}
+
+	// 出力先を開く前に検査する
+	var d *Data = nil
+	if arg.Validate {
+		if len(arg.Defines) == 0 {
+			panic("--validate requires --defines")
+		}
+		// 全件読み込むとmysqlの入力を1行ずつ出力できない
+		if detectDataInputFormat(arg.Inputs[0]) == "mysql" {
+			panic("--validate does not support mysql input (use data-lint)")
+		}
+		d = loadData(arg)
+		if errors := lintData(loadModelToMap(arg), d); len(errors) != 0 {
+			printDataLintErrors(os.Stderr, errors)
+			os.Exit(1)
+		}
+	}
 
-	if arg.Output == "" {
-		if format == "xlsx" {
-			panic("xlsx stdout")
+	var w rowWriter
+	switch format {
+	case "mysql":
+		w = newDbRowWriter(arg.Output, arg)
+	case "csv", "tsv":
+		w = newCsvRowWriter(arg.Output, format, arg)
+	case "testfixtures":
+		w = newFixtureRowWriter(arg.Output)
+	default:
+		var out io.Writer = os.Stdout
+		if arg.Output != "" {
+			f, err := os.Create(arg.Output)
+			checkError(err)
+			defer f.Close()
+			out = f
 		}
-		fmt.Println(string(b))
+		w = newRowWriter(format, out, arg)
+	}
+
+	// mysqlはテーブルを全件読み込まずに出力する
+	if d != nil {
+		writeData(d, w)
+	} else if detectDataInputFormat(arg.Inputs[0]) == "mysql" {
+		exportMysqlData(arg, w)
 	} else {
-		checkError(ioutil.WriteFile(arg.Output, b, os.ModePerm))
+		writeData(loadData(arg), w)
+	}
+	w.Close()
+}
+
+// 出力先がmysql dsnの場合はmysql
+func detectDataOutputFormat(arg *DataArg) string {
+	if arg.Format == "" && models.IsDsnString(arg.Output) {
+		return "mysql"
 	}
+	return detectOutputFormat(arg.Format, arg.Output)
+}
+
+// ディレクトリの場合は含まれるファイルの形式
+func detectDataInputFormat(input string) string {
+	if info, err := os.Stat(input); err == nil && info.IsDir() {
+		for _, path := range models.ResolvFilePathes(input) {
+			if format := models.DetectInputFormat(path); format != "mysql" {
+				return format
+			}
+		}
+		panic(fmt.Sprint("no data file in directory:", input))
+	}
+	return models.DetectInputFormat(input)
 }
 
 func loadData(arg *DataArg) *Data {
-	switch models.DetectInputFormat(arg.Inputs[0]) {
+	switch detectDataInputFormat(arg.Inputs[0]) {
 	case "xlsx":
 		return NewDataFromExcel(arg)
 	case "json":
 		return NewDataFromJson(arg)
+	case "csv", "tsv":
+		return NewDataFromCsv(arg)
+	case "yaml":
+		return NewDataFromYaml(arg)
 	case "mysql":
 		return NewDataFromMysql(arg)
 	}
 	panic(fmt.Sprint("input format invalid:", arg.Inputs))
 }
 
-func marshalData(d *Data, format string, args *DataArg) []byte {
-	switch format {
-	case "xlsx":
-		return d.ToExcelFile()
-	case "json":
-		return []byte(jsonutil.ToJson(d))
-	case "sql":
-		return []byte(d.ToSQL(args))
-	}
-	panic(fmt.Sprint("output format invalid:", format))
-}
-
 type tableMaps struct {
 	Tables map[string]*models.Table
 }
@@ -139,8 +299,23 @@ func (this *tableMaps) GetColumn(tableName, columnName string) *models.Column {
 	return this.Tables[tableName].GetColumn(columnName)
 }
 
+// 主キーのカラム名(テーブルがない場合はnil)
+func (this *tableMaps) GetPrimaryKeyNames(tableName string) []string {
+	if !this.ContainsTable(tableName) {
+		return nil
+	}
+	res := make([]string, 0)
+	for _, c := range this.Tables[tableName].PrimaryKeys {
+		res = append(res, c.Name.LowerSnake())
+	}
+	return res
+}
+
 func loadModelToMap(arg *DataArg) *tableMaps {
-	m := models.LoadModel(arg.IgnoreTables, arg.Defines...)
+	return newTableMaps(models.LoadModel(arg.IgnoreTables, arg.Defines...))
+}
+
+func newTableMaps(m *models.Models) *tableMaps {
 	res := &tableMaps{
 		Tables: make(map[string]*models.Table),
 	}
@@ -161,6 +336,39 @@ type TableData struct {
 	Name   string
 	Keys   []string
 	Values []DBRow
+	// Valuesの各行の読み込み元(mysqlから読み込んだ場合はnil)
+	Sources []DataSource `json:"-" yaml:"-"`
+}
+
+// 行の読み込み元(data-lintのエラー表示用)
+type DataSource struct {
+	File string
+	// シート名(Excel以外はテーブル名)
+	Sheet string
+	// Excel, csv, tsvは行番号、json, yamlはテーブル内の何行目か(0はテーブル全体)
+	Row int
+}
+
+func (this DataSource) String() string {
+	res := make([]string, 0)
+	if this.File != "" {
+		res = append(res, this.File)
+	}
+	if this.Sheet != "" {
+		res = append(res, this.Sheet)
+	}
+	if this.Row != 0 {
+		res = append(res, fmt.Sprintf("row %d", this.Row))
+	}
+	return strings.Join(res, " ")
+}
+
+// i行目の読み込み元(不明な場合はテーブル名と何行目か)
+func (this *TableData) Source(i int) DataSource {
+	if len(this.Sources) == len(this.Values) {
+		return this.Sources[i]
+	}
+	return DataSource{Sheet: this.Name, Row: i + 1}
 }
 
 func NewDataFromExcel(arg *DataArg) *Data {
@@ -182,9 +390,12 @@ func NewDataFromExcel(arg *DataArg) *Data {
 			}
 			//fmt.Println(path, sheet.Name)
 			t := NewDataFromExcelSheet(sheet)
-			if t == nil || len(t.Values) == 0 {
+			if t == nil || len(t.Values) == 0 && !arg.WritesEmptyTable(t.Name) {
 				continue
 			}
+			for i := range t.Sources {
+				t.Sources[i].File = path
+			}
 			// 同名テーブルはマージ(重複チェックはしない)
 			var exist *TableData = nil
 			for _, et := range res.Tables {
@@ -200,6 +411,7 @@ func NewDataFromExcel(arg *DataArg) *Data {
 						newRow = append(newRow, nv)
 					}
 					et.Values = newRow
+					et.Sources = append(et.Sources, t.Sources...)
 				}
 			}
 			// 既存が見つからなかった場合は追加
@@ -213,9 +425,10 @@ func NewDataFromExcel(arg *DataArg) *Data {
 
 func NewDataFromExcelSheet(sheet *xlsx.Sheet) *TableData {
 	res := &TableData{
-		Name:   sheet.Name,
-		Keys:   make([]string, 0),
-		Values: make([]DBRow, 0),
+		Name:    sheet.Name,
+		Keys:    make([]string, 0),
+		Values:  make([]DBRow, 0),
+		Sources: make([]DataSource, 0),
 	}
 	// keyのcell位置を保持
 	keyIndexMap := make(map[string]int)
@@ -246,6 +459,7 @@ func NewDataFromExcelSheet(sheet *xlsx.Sheet) *TableData {
 				dataRow = append(dataRow, escapeValue(getCellValue(row, n)))
 			}
 			res.Values = append(res.Values, dataRow)
+			res.Sources = append(res.Sources, DataSource{Sheet: sheet.Name, Row: i + 1})
 		}
 	}
 	return res
@@ -268,6 +482,7 @@ func NewDataFromJson(arg *DataArg) *Data {
 			if contains(arg.IgnoreTables, t.Name) {
 				continue
 			}
+			t.Sources = newDataSources(path, t)
 			targets = append(targets, t)
 		}
 
@@ -279,14 +494,22 @@ func NewDataFromJson(arg *DataArg) *Data {
 	return res
 }
 
-func NewDataFromMysql(arg *DataArg) *Data {
-	dsn := arg.Inputs[0]
-	db, err := gorm.Open(mysql.Open(dsn))
-	checkError(err)
-	res := &Data{
-		Tables: make([]*TableData, 0),
+// json, yamlの行の読み込み元(テーブル内の何行目か)
+func newDataSources(path string, t *TableData) []DataSource {
+	res := make([]DataSource, 0, len(t.Values))
+	for i := range t.Values {
+		res = append(res, DataSource{File: path, Sheet: t.Name, Row: i + 1})
 	}
+	return res
+}
 
+/**
+--tables, --ignore-tablesで選んだmysqlのテーブル
+--where, --limit等のテーブルの指定がどのテーブルにも一致しない場合は標準エラー出力に警告
+*/
+func loadMysqlDataTables(db *gorm.DB, arg *DataArg, filter *dataFilter) []models.MysqlTable {
+	res := make([]models.MysqlTable, 0)
+	names := make([]string, 0)
 	for _, tableInfo := range models.LoadMysqlTables(db) {
 		if !containsOrEmpty(arg.Tables, tableInfo.Name) {
 			continue
@@ -294,8 +517,29 @@ func NewDataFromMysql(arg *DataArg) *Data {
 		if contains(arg.IgnoreTables, tableInfo.Name) {
 			continue
 		}
-		t := NewTableDataFromMysql(db, tableInfo)
-		if len(t.Values) == 0 {
+		// syncは出力しない行を削除するため、一部の行のみ読み込むとテーブルの他の行が削除される
+		if filter.Table(tableInfo.Name) != nil && arg.Mode != "" && arg.TableMode(tableInfo.Name) == dataModeSync {
+			panic(fmt.Sprintf("--filters, --where, --order-by, --limit, --sample cannot be used with sync mode: %s", tableInfo.Name))
+		}
+		res = append(res, tableInfo)
+		names = append(names, tableInfo.Name)
+	}
+	filter.WarnUnmatched(os.Stderr, names)
+	return res
+}
+
+func NewDataFromMysql(arg *DataArg) *Data {
+	filter := loadDataFilter(arg)
+	dsn := arg.Inputs[0]
+	db, err := gorm.Open(mysql.Open(dsn))
+	checkError(err)
+	res := &Data{
+		Tables: make([]*TableData, 0),
+	}
+
+	for _, tableInfo := range loadMysqlDataTables(db, arg, filter) {
+		t := NewTableDataFromMysql(db, tableInfo, filter)
+		if len(t.Values) == 0 && !arg.WritesEmptyTable(t.Name) {
 			continue
 		}
 		res.Tables = append(res.Tables, t)
@@ -303,118 +547,66 @@ func NewDataFromMysql(arg *DataArg) *Data {
 
 	return res
 }
-func NewTableDataFromMysql(db *gorm.DB, tableInfo models.MysqlTable) *TableData {
+func NewTableDataFromMysql(db *gorm.DB, tableInfo models.MysqlTable, filter *dataFilter) *TableData {
 	res := &TableData{
 		Name:   tableInfo.Name,
+		Keys:   loadMysqlColumnNames(db, tableInfo),
 		Values: make([]DBRow, 0),
 	}
-	db.Raw("select column_name from information_schema.columns where table_schema = database() and table_name = ? order by ordinal_position", tableInfo.GetName()).Scan(&res.Keys)
 
-	var results []map[string]interface{}
-	err := db.Table(tableInfo.Name).Find(&results).Error
-	checkError(err)
-	fmt.Println(tableInfo.Name)
-	b, _ := json.Marshal(results)
-	fmt.Println(string(b))
-
-	for _, row := range results {
-		values := make(DBRow, 0)
-		for _, c := range res.Keys {
-			values = append(values, row[c])
-		}
-		res.Values = append(res.Values, values)
+	cursor := newMysqlRowCursor(db, tableInfo.Name, res.Keys, filter)
+	defer cursor.Close()
+	for cursor.Next() {
+		res.Values = append(res.Values, cursor.Row())
 	}
-
 	return res
 }
 
-func (this Data) ToExcelFile() []byte {
-	file := xlsx.NewFile()
-
-	for _, t := range this.Tables {
-		sheet, err := file.AddSheet(t.Name)
-		checkError(err)
-		t.ToExcelSheet(sheet)
-	}
-
-	buf := bytes.NewBuffer(nil)
-	file.Write(buf)
-	return buf.Bytes()
-}
+/**
+mysqlのデータを1行ずつ出力する
+メモリ使用量はテーブルの行数に依存しない
+進捗は標準エラー出力
+*/
+func exportMysqlData(arg *DataArg, w rowWriter) {
+	filter := loadDataFilter(arg)
+	dsn := arg.Inputs[0]
+	db, err := gorm.Open(mysql.Open(dsn))
+	checkError(err)
 
-func (this TableData) ToExcelSheet(sheet *xlsx.Sheet) {
-	//カラムヘッダー行
-	tableHeaderRow := sheet.AddRow()
-	for _, v := range this.Keys {
-		models.SetHeaderStyle(tableHeaderRow.AddCell()).SetValue(v)
-	}
+	for _, tableInfo := range loadMysqlDataTables(db, arg, filter) {
+		keys := loadMysqlColumnNames(db, tableInfo)
+		estimate := tableInfo.Rows.Int64
+		if t := filter.Table(tableInfo.Name); t != nil {
+			estimate = t.EstimateRows(estimate)
+		}
+		progress := newDataProgress(os.Stderr, tableInfo.Name, estimate)
 
-	//データ行
-	for _, values := range this.Values {
-		tableRow := sheet.AddRow()
-		for _, v := range values {
-			tableRow.AddCell().SetValue(v)
+		cursor := newMysqlRowCursor(db, tableInfo.Name, keys, filter)
+		// 空のテーブルは出力しない(syncは除く)
+		writesEmpty := arg.WritesEmptyTable(tableInfo.Name)
+		if writesEmpty {
+			w.BeginTable(tableInfo.Name, keys)
+		}
+		for cursor.Next() {
+			if progress.Rows == 0 && !writesEmpty {
+				w.BeginTable(tableInfo.Name, keys)
+			}
+			w.WriteRow(cursor.Row())
+			progress.Add(1)
+		}
+		cursor.Close()
+		if progress.Rows != 0 || writesEmpty {
+			w.EndTable()
 		}
+		progress.Done()
 	}
 }
 
 func (this Data) ToSQL(args *DataArg) string {
-	var defines *tableMaps = nil
-	if 0 < len(args.Defines) {
-		defines = loadModelToMap(args)
-	}
-
 	buf := bytes.NewBuffer(nil)
-	for _, t := range this.Tables {
-		// TRUNCATEのフラグ制御
-		if !args.SkipTruncate {
-			buf.WriteString("TRUNCATE `")
-			buf.WriteString(t.Name)
-			buf.WriteString("`;\n")
-		}
-
-		buf.WriteString("INSERT INTO `")
-		buf.WriteString(t.Name)
-		buf.WriteString("` ")
-
-		//keys
-		keys := make([]string, 0)
-		for _, k := range t.Keys {
-			keys = append(keys, "`"+k+"`")
-		}
-		buf.WriteString("(")
-		buf.WriteString(strings.Join(keys, ", "))
-		buf.WriteString(") ")
-
-		valuesList := make([]string, 0)
-		for _, row := range t.Values {
-			values := make([]string, 0)
-			for i, rawV := range row {
-				v := ToString(rawV)
-				if strings.ToLower(v) == "null" {
-					values = append(values, "null")
-
-				} else if v == "" && defines != nil {
-					// データが空の場合、columnを取得
-					if col := defines.GetColumn(t.Name, t.Keys[i]); col != nil {
-						// columnがある場合はdefaultを突っ込む
-						values = append(values, "'"+col.Default.ValueOrZero()+"'")
-					} else {
-						// columnがない場合はそのまま突っ込む
-						values = append(values, "'"+v+"'")
-					}
-
-				} else {
-					values = append(values, "'"+v+"'")
-				}
-			}
-			valuesList = append(valuesList, "("+strings.Join(values, ",")+")")
-		}
-
-		buf.WriteString("\nVALUES \n")
-		buf.WriteString(strings.Join(valuesList, ",\n"))
-		buf.WriteString(";\n\n")
-	}
+	w := newSqlRowWriter(buf, args)
+	writeData(&this, w)
+	w.Close()
 	return buf.String()
 }
 
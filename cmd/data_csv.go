@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+)
+
+// UTF-8のBOM(Excelで開く場合に必要)
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// クォートの方法
+const (
+	// 区切り文字, クォート, 改行を含む場合のみ
+	csvQuoteMinimal = "minimal"
+	// 全て
+	csvQuoteAll = "all"
+	// クォートしない(区切り文字, 改行を含む値はエラー)
+	csvQuoteNone = "none"
+)
+
+func csvComma(format string) rune {
+	if format == "tsv" {
+		return '\t'
+	}
+	return ','
+}
+
+/**
+CSV, TSV(1ファイル1テーブル、ファイル名がテーブル名)
+	ディレクトリの場合は含まれる.csv, .tsvファイル
+	1行目はヘッダー(--no-headerの場合は--definesのカラム順)
+	--nullの値はnull
+	先頭のBOMは無視する
+*/
+func NewDataFromCsv(arg *DataArg) *Data {
+	var defines *tableMaps = nil
+	if arg.NoHeader {
+		if len(arg.Defines) == 0 {
+			panic("--no-header requires --defines")
+		}
+		defines = loadModelToMap(arg)
+	}
+
+	res := &Data{
+		Tables: make([]*TableData, 0),
+	}
+	for _, path := range models.ResolvFilePathes(arg.Inputs...) {
+		format := models.DetectInputFormat(path)
+		if format != "csv" && format != "tsv" {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if strings.HasPrefix(name, "_") {
+			continue
+		}
+		if !containsOrEmpty(arg.Tables, name) {
+			continue
+		}
+		if contains(arg.IgnoreTables, name) {
+			continue
+		}
+
+		var keys []string = nil
+		if arg.NoHeader {
+			if !defines.ContainsTable(strings.ToLower(name)) {
+				panic(fmt.Sprintf("table not found in --defines: %s", name))
+			}
+			keys = defines.Tables[strings.ToLower(name)].GetColumnNames()
+		}
+		t := NewTableDataFromCsv(path, name, csvComma(format), keys, arg.Null)
+		if len(t.Values) == 0 && !arg.WritesEmptyTable(t.Name) {
+			continue
+		}
+		// 同名テーブルはマージ(重複チェックはしない)
+		if exist := findTableData(res.Tables, t.Name); exist != nil {
+			for _, row := range t.Values {
+				exist.Values = append(exist.Values, projectRow(row, t.Keys, exist.Keys))
+			}
+			exist.Sources = append(exist.Sources, t.Sources...)
+		} else {
+			res.Tables = append(res.Tables, t)
+		}
+	}
+	return res
+}
+
+// keysがnilの場合は1行目がヘッダー
+func NewTableDataFromCsv(path string, name string, comma rune, keys []string, null string) *TableData {
+	f, err := os.Open(path)
+	checkError(err)
+	defer f.Close()
+	br := bufio.NewReader(f)
+	if b, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(b, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+
+	r := csv.NewReader(br)
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = comma == '\t'
+
+	res := &TableData{
+		Name:    name,
+		Keys:    keys,
+		Values:  make([]DBRow, 0),
+		Sources: make([]DataSource, 0),
+	}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			panic(fmt.Sprintf("%s: %v", path, err))
+		}
+		if res.Keys == nil {
+			res.Keys = make([]string, 0)
+			for _, v := range record {
+				res.Keys = append(res.Keys, strings.TrimSpace(v))
+			}
+			continue
+		}
+		if len(res.Keys) < len(record) {
+			panic(fmt.Sprintf("%s: too many fields: line %d", path, len(res.Values)+2))
+		}
+		row := make(DBRow, 0, len(res.Keys))
+		for i := range res.Keys {
+			v := ""
+			if i < len(record) {
+				v = record[i]
+			}
+			row = append(row, fromCsvValue(v, null))
+		}
+		res.Values = append(res.Values, row)
+		line, _ := r.FieldPos(0)
+		res.Sources = append(res.Sources, DataSource{File: path, Row: line})
+	}
+	return res
+}
+
+/**
+CSVの値をデータの値にする
+	--nullの値はnull、--nullの値の前に\を付けた値は\を1つ除いた文字列
+	--nullが"null"の場合は大文字小文字を区別しない
+*/
+func fromCsvValue(v string, null string) DBValue {
+	if equalCsvNull(v, null) {
+		return "null"
+	}
+	if isEscapedCsvNull(v, null) {
+		v = v[1:]
+	}
+	return toDataString(v)
+}
+
+// 文字列をCSVの値にする(fromCsvValueの逆)
+func toCsvValue(v string, null string) string {
+	if equalCsvNull(v, null) || isEscapedCsvNull(v, null) {
+		return `\` + v
+	}
+	return v
+}
+
+func equalCsvNull(v string, null string) bool {
+	if strings.EqualFold(null, "null") {
+		return strings.EqualFold(v, null)
+	}
+	return v == null
+}
+
+// --nullの値の前に\を1つ以上付けた値
+func isEscapedCsvNull(v string, null string) bool {
+	for strings.HasPrefix(v, `\`) {
+		v = v[1:]
+		if equalCsvNull(v, null) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+CSV, TSV出力(OUTPUTのディレクトリに<テーブル名>.csv, .tsv)
+値は "data -f sql | exec" で書き込まれる値(エスケープを解除、文字列"null"は"null")
+	--nullの値と同じ文字列(--nullの値の前に\を付けた文字列を含む)は前に\を付ける
+*/
+type csvRowWriter struct {
+	dir    string
+	ext    string
+	comma  rune
+	header bool
+	null   string
+	quote  string
+	bom    bool
+
+	file *os.File
+	w    *bufio.Writer
+	name string
+	line int
+}
+
+func newCsvRowWriter(dir string, format string, arg *DataArg) *csvRowWriter {
+	if dir == "" {
+		panic(format + " requires output directory")
+	}
+	if arg.Quote != csvQuoteMinimal && arg.Quote != csvQuoteAll && arg.Quote != csvQuoteNone {
+		panic(fmt.Sprintf("quote invalid: %s (%s, %s, %s)", arg.Quote, csvQuoteMinimal, csvQuoteAll, csvQuoteNone))
+	}
+	checkError(os.MkdirAll(dir, os.ModePerm))
+	return &csvRowWriter{
+		dir:    dir,
+		ext:    "." + format,
+		comma:  csvComma(format),
+		header: !arg.NoHeader,
+		null:   arg.Null,
+		quote:  arg.Quote,
+		bom:    arg.Bom,
+	}
+}
+
+func (this *csvRowWriter) BeginTable(name string, keys []string) {
+	f, err := os.Create(filepath.Join(this.dir, name+this.ext))
+	checkError(err)
+	this.file = f
+	this.w = bufio.NewWriter(f)
+	this.name = name
+	this.line = 0
+	if this.bom {
+		this.w.Write(utf8BOM)
+	}
+	if this.header {
+		fields := make([]string, 0, len(keys))
+		for _, k := range keys {
+			fields = append(fields, this.quoteField(k))
+		}
+		this.writeLine(fields)
+	}
+}
+
+func (this *csvRowWriter) WriteRow(row DBRow) {
+	fields := make([]string, 0, len(row))
+	for _, rawV := range row {
+		v, ok := fromDataString(rawV)
+		if !ok {
+			fields = append(fields, this.null)
+			continue
+		}
+		fields = append(fields, this.quoteField(toCsvValue(v, this.null)))
+	}
+	this.writeLine(fields)
+}
+
+func (this *csvRowWriter) writeLine(fields []string) {
+	this.line++
+	this.w.WriteString(strings.Join(fields, string(this.comma)))
+	this.w.WriteString("\n")
+}
+
+func (this *csvRowWriter) quoteField(v string) string {
+	switch this.quote {
+	case csvQuoteAll:
+	case csvQuoteNone:
+		if strings.ContainsAny(v, string(this.comma)+"\r\n") {
+			panic(fmt.Sprintf("value contains a separator or newline with --quote none: %s line %d", this.name, this.line+1))
+		}
+		return v
+	default:
+		if v == "" || !strings.ContainsAny(v, string(this.comma)+"\"\r\n") && v[0] != ' ' && v[0] != '\t' {
+			return v
+		}
+	}
+	return `"` + strings.Replace(v, `"`, `""`, -1) + `"`
+}
+
+func (this *csvRowWriter) EndTable() {
+	checkError(this.w.Flush())
+	checkError(this.file.Close())
+	fmt.Println(this.file.Name())
+}
+
+func (this *csvRowWriter) Close() {
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import "testing"
+
+func TestCsvValue(t *testing.T) {
+	cases := []struct {
+		null string
+		v    string
+		csv  string
+	}{
+		{`\N`, `\N`, `\\N`},
+		{`\N`, `\\N`, `\\\N`},
+		{`\N`, `\n`, `\n`},
+		{`\N`, "null", "null"},
+		{`\N`, `\null`, `\null`},
+		{"null", "null", `\null`},
+		{"null", "NULL", `\NULL`},
+		{"null", `\null`, `\\null`},
+		{"null", `\N`, `\N`},
+		{"NULL", "null", `\null`},
+		{"", "", `\`},
+		{"", `\`, `\\`},
+		{"", "a", "a"},
+	}
+	for _, c := range cases {
+		if got := toCsvValue(c.v, c.null); got != c.csv {
+			t.Errorf("null %q, %q: got %q, want %q", c.null, c.v, got, c.csv)
+		}
+		if got, want := fromCsvValue(c.csv, c.null), toDataString(c.v); got != want {
+			t.Errorf("null %q, %q: read %q, want %q", c.null, c.csv, got, want)
+		}
+	}
+	for _, c := range []struct{ null, csv string }{{`\N`, `\N`}, {"null", "NULL"}, {"", ""}} {
+		if got := fromCsvValue(c.csv, c.null); got != "null" {
+			t.Errorf("null %q, %q: got %q, want null", c.null, c.csv, got)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"database/sql"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+	"gorm.io/gorm"
+)
+
+// テーブルの行を1行ずつ読み込む
+type rowCursor interface {
+	Next() bool
+	Row() DBRow
+	Close()
+}
+
+// mysqlのテーブルを全件読み込まずに1行ずつ読み込む
+type mysqlRowCursor struct {
+	db   *gorm.DB
+	rows *sql.Rows
+	keys []string
+	row  DBRow
+}
+
+// filterがnilの場合は全件
+func newMysqlRowCursor(db *gorm.DB, tableName string, keys []string, filter *dataFilter) *mysqlRowCursor {
+	rows, err := filterMysqlRows(db, tableName, filter).Rows()
+	checkError(err)
+	return &mysqlRowCursor{
+		db:   db,
+		rows: rows,
+		keys: keys,
+	}
+}
+
+// --filtersなどの条件(WHERE, ORDER BY, LIMIT)
+func filterMysqlRows(db *gorm.DB, tableName string, filter *dataFilter) *gorm.DB {
+	query := db.Table(tableName)
+	t := filter.Table(tableName)
+	if t == nil {
+		return query
+	}
+	where, orderBy, limit := t.Query(filter.Rand(), func() []string {
+		return loadMysqlPrimaryKeyNames(db, tableName)
+	})
+	for _, condition := range where {
+		query = query.Where(condition)
+	}
+	if orderBy != "" {
+		query = query.Order(orderBy)
+	}
+	if limit != 0 {
+		query = query.Limit(limit)
+	}
+	return query
+}
+
+func (this *mysqlRowCursor) Next() bool {
+	if !this.rows.Next() {
+		checkError(this.rows.Err())
+		return false
+	}
+	// gormのFind(&[]map[string]interface{})と同じ値に変換する
+	values := make(map[string]interface{})
+	checkError(this.db.ScanRows(this.rows, &values))
+	this.row = make(DBRow, 0, len(this.keys))
+	for _, key := range this.keys {
+		this.row = append(this.row, toMysqlDataValue(values[key]))
+	}
+	return true
+}
+
+// 文字列はExcel, jsonなどの入力と同じ値にする(toDataString)
+func toMysqlDataValue(v interface{}) DBValue {
+	switch t := v.(type) {
+	case string:
+		return toDataString(t)
+	case []byte:
+		return toDataString(string(t))
+	}
+	return v
+}
+
+func (this *mysqlRowCursor) Row() DBRow {
+	return this.row
+}
+
+func (this *mysqlRowCursor) Close() {
+	checkError(this.rows.Close())
+}
+
+// カラム名(定義順)
+func loadMysqlColumnNames(db *gorm.DB, tableInfo models.MysqlTable) []string {
+	keys := make([]string, 0)
+	checkError(db.Raw("select column_name from information_schema.columns where table_schema = database() and table_name = ? order by ordinal_position", tableInfo.GetName()).Scan(&keys).Error)
+	return keys
+}
+
+// 主キーのカラム名(定義順)
+func loadMysqlPrimaryKeyNames(db *gorm.DB, tableName string) []string {
+	keys := make([]string, 0)
+	checkError(db.Raw("select column_name from information_schema.key_column_usage where table_schema = database() and table_name = ? and constraint_name = 'PRIMARY' order by ordinal_position", tableName).Scan(&keys).Error)
+	return keys
+}
+
+// 読み込み済みのテーブルデータ
+type tableDataCursor struct {
+	table *TableData
+	index int
+}
+
+func newTableDataCursor(t *TableData) *tableDataCursor {
+	return &tableDataCursor{
+		table: t,
+		index: -1,
+	}
+}
+
+func (this *tableDataCursor) Next() bool {
+	this.index++
+	return this.index < len(this.table.Values)
+}
+
+func (this *tableDataCursor) Row() DBRow {
+	return this.table.Values[this.index]
+}
+
+func (this *tableDataCursor) Close() {
+}
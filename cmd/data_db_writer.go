@@ -0,0 +1,495 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// 出力先がmysqlの場合のINSERT文1つの行数(--rows-per-insertの指定がない場合)
+const dbRowsPerInsert = 1000
+
+// プレースホルダの最大数
+const dbMaxPlaceholders = 65535
+
+// テーブル毎の書き込み方法
+const (
+	// TRUNCATE + INSERT
+	dataModeTruncate = "truncate"
+	// DELETE + INSERT(TRUNCATEと異なりトランザクション内で実行)
+	dataModeDelete = "delete"
+	// INSERTのみ
+	dataModeInsert = "insert"
+	// INSERT ... ON DUPLICATE KEY UPDATE
+	dataModeUpsert = "upsert"
+	// REPLACE
+	dataModeReplace = "replace"
+	// INSERT IGNORE
+	dataModeIgnore = "ignore"
+	// 主キー(--defines)で突き合わせて追加, 変更, 削除
+	dataModeSync = "sync"
+)
+
+var dataModes = []string{dataModeTruncate, dataModeDelete, dataModeInsert, dataModeUpsert, dataModeReplace, dataModeIgnore, dataModeSync}
+
+/**
+テーブル毎の書き込み方法
+	--table-mode TABLE:MODE > --skip-truncate(insert) > --mode
+*/
+func (this *DataArg) TableMode(tableName string) string {
+	mode := this.Mode
+	if this.SkipTruncate && mode == dataModeTruncate {
+		mode = dataModeInsert
+	}
+	for _, tableMode := range this.TableModes {
+		tmp := strings.SplitN(tableMode, ":", 2)
+		if len(tmp) != 2 {
+			panic(fmt.Sprintf("--table-mode must be TABLE:MODE: %s", tableMode))
+		}
+		if tmp[0] == tableName {
+			mode = tmp[1]
+		}
+	}
+	if !contains(dataModes, mode) {
+		panic(fmt.Sprintf("mode invalid: %s (%s)", mode, strings.Join(dataModes, ", ")))
+	}
+	return mode
+}
+
+// 行のないテーブルも出力するか(syncは全行を削除するため)
+func (this *DataArg) WritesEmptyTable(tableName string) bool {
+	return this.Mode != "" && this.TableMode(tableName) == dataModeSync
+}
+
+func insertStatement(mode string) string {
+	switch mode {
+	case dataModeReplace:
+		return "REPLACE INTO"
+	case dataModeIgnore:
+		return "INSERT IGNORE INTO"
+	}
+	return "INSERT INTO"
+}
+
+// keysは`で囲んだカラム名
+func onDuplicateKeyUpdate(keys []string) string {
+	updates := make([]string, 0)
+	for _, k := range keys {
+		updates = append(updates, k+" = VALUES("+k+")")
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+}
+
+// syncの主キー(--definesのテーブル定義)
+func syncPrimaryKeyNames(defines *tableMaps, tableName string) []string {
+	if defines == nil {
+		panic("sync mode requires --defines")
+	}
+	pk := defines.GetPrimaryKeyNames(tableName)
+	if len(pk) == 0 {
+		panic(fmt.Sprintf("sync mode requires primary key in --defines: %s", tableName))
+	}
+	return pk
+}
+
+func syncPrimaryKeyIndexes(defines *tableMaps, tableName string, keys []string) []int {
+	res := make([]int, 0)
+	for _, name := range syncPrimaryKeyNames(defines, tableName) {
+		index := indexOfKey(keys, name)
+		if index < 0 {
+			panic(fmt.Sprintf("primary key column not found in data: %s.%s", tableName, name))
+		}
+		res = append(res, index)
+	}
+	return res
+}
+
+// テーブル毎の書き込み結果
+type dbLoadSummary struct {
+	Name      string
+	Mode      string
+	Rows      int64
+	Deleted   int64
+	Affected  int64
+	Inserted  int64
+	Updated   int64
+	Unchanged int64
+}
+
+/**
+mysqlへ直接書き込む
+	プリペアドステートメントの複数行INSERTをテーブル毎のトランザクションで実行
+	(--batches-per-transactionの指定があればINSERT文N個毎にCOMMIT)
+	TRUNCATEは暗黙のCOMMITが発生するためトランザクションの前に実行
+	値は "data -f sql | exec" と同じ(null, 空の場合のdefault, エスケープの解除)
+	syncはテーブルの行(主キーと出力するカラム)をメモリに読み込み、差分の行のみ追加, 変更, 削除
+*/
+type dbRowWriter struct {
+	ctx  context.Context
+	db   *sql.DB
+	conn *sql.Conn
+
+	defines               *tableMaps
+	arg                   *DataArg
+	batchesPerTransaction int
+
+	summary   *dbLoadSummary
+	summaries []*dbLoadSummary
+	keys      []string
+	batchRows int
+	batch     []interface{}
+	batches   int
+	tx        *sql.Tx
+	stmt      *sql.Stmt
+	// sync
+	differ *rowDiffer
+	// カラム毎に評価した式のデフォルト値
+	expressions map[string]interface{}
+}
+
+func newDbRowWriter(dsn string, arg *DataArg) *dbRowWriter {
+	gdb, err := gorm.Open(mysql.Open(dsn))
+	checkError(err)
+	db, err := gdb.DB()
+	checkError(err)
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	checkError(err)
+
+	res := &dbRowWriter{
+		ctx:                   ctx,
+		db:                    db,
+		conn:                  conn,
+		arg:                   arg,
+		batchesPerTransaction: arg.BatchesPerTransaction,
+		summaries:             make([]*dbLoadSummary, 0),
+	}
+	if 0 < len(arg.Defines) {
+		res.defines = loadModelToMap(arg)
+	}
+	return res
+}
+
+func (this *dbRowWriter) BeginTable(name string, keys []string) {
+	this.summary = &dbLoadSummary{
+		Name: name,
+		Mode: this.arg.TableMode(name),
+	}
+	this.summaries = append(this.summaries, this.summary)
+	this.keys = keys
+	this.batches = 0
+	this.expressions = map[string]interface{}{}
+
+	this.batchRows = this.arg.RowsPerInsert
+	if this.batchRows == 0 {
+		this.batchRows = dbRowsPerInsert
+	}
+	if 0 < len(keys) && dbMaxPlaceholders/len(keys) < this.batchRows {
+		this.batchRows = dbMaxPlaceholders / len(keys)
+	}
+	this.batch = make([]interface{}, 0, this.batchRows*len(keys))
+
+	if this.summary.Mode == dataModeTruncate {
+		_, err := this.conn.ExecContext(this.ctx, "TRUNCATE `"+name+"`")
+		checkError(err)
+	}
+	this.begin()
+	switch this.summary.Mode {
+	case dataModeDelete:
+		res, err := this.tx.ExecContext(this.ctx, "DELETE FROM `"+name+"`")
+		checkError(err)
+		this.summary.Deleted, err = res.RowsAffected()
+		checkError(err)
+	case dataModeSync:
+		this.differ = newRowDiffer(name, keys, syncPrimaryKeyNames(this.defines, name))
+		this.loadSyncRows()
+	}
+}
+
+// syncの比較対象(テーブルの現在の行、値は書き込む値と同じ形式にする)
+func (this *dbRowWriter) loadSyncRows() {
+	rows, err := this.tx.QueryContext(this.ctx, "SELECT "+strings.Join(quoteKeys(this.keys), ", ")+" FROM `"+this.summary.Name+"`")
+	checkError(err)
+	defer rows.Close()
+	values := make([]sql.NullString, len(this.keys))
+	dest := make([]interface{}, len(this.keys))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		checkError(rows.Scan(dest...))
+		row := make(DBRow, 0, len(values))
+		for i, v := range values {
+			row = append(row, this.toSyncValue(this.keys[i], v))
+		}
+		this.differ.AddOld(row)
+	}
+	checkError(rows.Err())
+}
+
+/**
+mysqlから読み込んだ値を書き込む値(toDBValue)と同じ形式にする
+	bitはバイト列を10進数、それ以外はmysqlからの読み込み(toMysqlDataValue)と同じ文字列をtoColumnValue
+	空文字列はデフォルト値にせずそのまま
+*/
+func (this *dbRowWriter) toSyncValue(key string, v sql.NullString) DBValue {
+	if !v.Valid {
+		return nil
+	}
+	col := this.defines.GetColumn(this.summary.Name, key)
+	if col == nil || v.String == "" {
+		return v.String
+	}
+	if columnValueType(col) == columnValueBit {
+		return toColumnArg(col, fromMysqlBitValue(v.String))
+	}
+	return toColumnArg(col, toColumnValue(col, toMysqlDataValue(v.String)))
+}
+
+// 比較用の値(normalizeDBValue)をプレースホルダの値に戻す
+func (this *dbRowWriter) toSyncArg(key string, v DBValue) interface{} {
+	return toColumnArg(this.defines.GetColumn(this.summary.Name, key), v)
+}
+
+func (this *dbRowWriter) WriteRow(row DBRow) {
+	this.summary.Rows++
+	values := make(DBRow, 0, len(row))
+	for i, v := range row {
+		values = append(values, this.toDBValue(this.keys[i], v))
+	}
+	if this.summary.Mode == dataModeSync {
+		change := this.differ.Diff(values)
+		if change == nil {
+			this.summary.Unchanged++
+			return
+		}
+		if change.Type == rowChangeUpdate {
+			this.update(change)
+			return
+		}
+		this.summary.Inserted++
+	}
+
+	for _, v := range values {
+		this.batch = append(this.batch, v)
+	}
+	if len(this.batch) == this.batchRows*len(this.keys) {
+		this.flush()
+	}
+}
+
+func (this *dbRowWriter) EndTable() {
+	this.flush()
+	if this.summary.Mode == dataModeSync {
+		for _, change := range this.differ.Deleted() {
+			this.delete(change)
+		}
+		this.differ = nil
+	}
+	this.commit()
+}
+
+// 変更されたカラムのみ更新
+func (this *dbRowWriter) update(change *rowChange) {
+	sets := make([]string, 0)
+	args := make([]interface{}, 0)
+	for _, i := range change.Columns {
+		sets = append(sets, "`"+this.keys[i]+"` = ?")
+		args = append(args, this.toSyncArg(this.keys[i], change.New[i]))
+	}
+	where, pkArgs := this.primaryKeyCondition(change.New)
+	_, err := this.tx.ExecContext(this.ctx, "UPDATE `"+this.summary.Name+"` SET "+strings.Join(sets, ", ")+" WHERE "+where, append(args, pkArgs...)...)
+	checkError(err)
+	this.summary.Updated++
+}
+
+func (this *dbRowWriter) delete(change *rowChange) {
+	where, args := this.primaryKeyCondition(change.Old)
+	_, err := this.tx.ExecContext(this.ctx, "DELETE FROM `"+this.summary.Name+"` WHERE "+where, args...)
+	checkError(err)
+	this.summary.Deleted++
+}
+
+func (this *dbRowWriter) primaryKeyCondition(row DBRow) (string, []interface{}) {
+	conditions := make([]string, 0)
+	for _, k := range this.differ.PrimaryKeyNames() {
+		conditions = append(conditions, "`"+k+"` = ?")
+	}
+	args := make([]interface{}, 0)
+	for i, v := range this.differ.PrimaryKeyValues(row) {
+		args = append(args, this.toSyncArg(this.differ.PrimaryKeyNames()[i], v))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+func (this *dbRowWriter) Close() {
+	checkError(this.conn.Close())
+	checkError(this.db.Close())
+
+	// テーブル毎の件数
+	for _, s := range this.summaries {
+		switch s.Mode {
+		case dataModeDelete:
+			fmt.Printf("%s: %s %d rows (deleted %d rows)\n", s.Name, s.Mode, s.Rows, s.Deleted)
+		case dataModeUpsert, dataModeReplace, dataModeIgnore:
+			// upsertは追加は1行, 更新は2行, 変更なしは0行として数えられる
+			fmt.Printf("%s: %s %d rows (affected %d rows)\n", s.Name, s.Mode, s.Rows, s.Affected)
+		case dataModeSync:
+			fmt.Printf("%s: %s %d rows (inserted %d, updated %d, deleted %d, unchanged %d rows)\n", s.Name, s.Mode, s.Rows, s.Inserted, s.Updated, s.Deleted, s.Unchanged)
+		default:
+			fmt.Printf("%s: %s %d rows\n", s.Name, s.Mode, s.Rows)
+		}
+	}
+}
+
+func (this *dbRowWriter) begin() {
+	tx, err := this.conn.BeginTx(this.ctx, nil)
+	checkError(err)
+	this.tx = tx
+	this.stmt = nil
+}
+
+func (this *dbRowWriter) commit() {
+	checkError(this.tx.Commit())
+	this.tx = nil
+	this.stmt = nil
+}
+
+func (this *dbRowWriter) flush() {
+	if len(this.batch) == 0 {
+		return
+	}
+	rows := len(this.batch) / len(this.keys)
+
+	// 行数が同じ間はステートメントを再利用(トランザクション終了時に破棄される)
+	stmt := this.stmt
+	if stmt == nil || rows != this.batchRows {
+		var err error
+		stmt, err = this.tx.PrepareContext(this.ctx, this.insertSQL(rows))
+		checkError(err)
+		if rows == this.batchRows {
+			this.stmt = stmt
+		} else {
+			defer stmt.Close()
+		}
+	}
+	res, err := stmt.ExecContext(this.ctx, this.batch...)
+	checkError(err)
+	affected, err := res.RowsAffected()
+	checkError(err)
+	this.summary.Affected += affected
+	this.batch = this.batch[:0]
+
+	this.batches++
+	if this.batchesPerTransaction != 0 && this.batches%this.batchesPerTransaction == 0 {
+		this.commit()
+		this.begin()
+	}
+}
+
+func (this *dbRowWriter) insertSQL(rows int) string {
+	keys := quoteKeys(this.keys)
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?,", len(this.keys)), ",") + ")"
+	values := make([]string, 0, rows)
+	for i := 0; i < rows; i++ {
+		values = append(values, placeholders)
+	}
+
+	res := insertStatement(this.summary.Mode) + " `" + this.summary.Name + "` (" + strings.Join(keys, ", ") + ") VALUES " + strings.Join(values, ",")
+	if this.summary.Mode == dataModeUpsert {
+		res += " " + onDuplicateKeyUpdate(keys)
+	}
+	return res
+}
+
+func quoteKeys(keys []string) []string {
+	res := make([]string, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, "`"+k+"`")
+	}
+	return res
+}
+
+// 式(sqlExpression)はテーブル毎に1回mysqlで評価する
+func (this *dbRowWriter) toDBValue(key string, rawV DBValue) interface{} {
+	var col *models.Column = nil
+	if this.defines != nil {
+		col = this.defines.GetColumn(this.summary.Name, key)
+	}
+	v := toColumnValue(col, rawV)
+	if expr, ok := v.(sqlExpression); ok {
+		return this.evaluate(key, col, expr)
+	}
+	return toColumnArg(col, v)
+}
+
+func (this *dbRowWriter) evaluate(key string, col *models.Column, expr sqlExpression) interface{} {
+	if v, ok := this.expressions[key]; ok {
+		return v
+	}
+	var res sql.NullString
+	checkError(this.tx.QueryRowContext(this.ctx, "SELECT "+string(expr)).Scan(&res))
+	var v interface{} = nil
+	if res.Valid {
+		v = toColumnArg(col, res.String)
+	}
+	this.expressions[key] = v
+	return v
+}
+
+/**
+sqlRowWriter.toSQLValueと同じ値(toColumnValue)
+	"null"はnil、空の場合は--definesのdefault、文字列はエスケープを解除
+*/
+func toDataValue(defines *tableMaps, tableName, key string, rawV DBValue) DBValue {
+	if defines == nil {
+		return toColumnValue(nil, rawV)
+	}
+	return toColumnValue(defines.GetColumn(tableName, key), rawV)
+}
+
+// mysqlの文字列リテラルのエスケープを解除する(escapeValueの逆)
+func unescapeValue(v string) string {
+	if !strings.Contains(v, "\\") {
+		return v
+	}
+	b := strings.Builder{}
+	escape := false
+	for _, c := range v {
+		if !escape {
+			if c == '\\' {
+				escape = true
+			} else {
+				b.WriteRune(c)
+			}
+			continue
+		}
+		escape = false
+		switch c {
+		case '0':
+			b.WriteRune(0)
+		case 'b':
+			b.WriteRune('\b')
+		case 'n':
+			b.WriteRune('\n')
+		case 'r':
+			b.WriteRune('\r')
+		case 't':
+			b.WriteRune('\t')
+		case 'Z':
+			b.WriteRune(0x1a)
+		case '%', '_':
+			// LIKEのワイルドカードはバックスラッシュを残す
+			b.WriteRune('\\')
+			b.WriteRune(c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
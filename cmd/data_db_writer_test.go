@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+	"github.com/alfalfalfa/mysql_tool/util"
+)
+
+func TestDbRowWriterSyncValue(t *testing.T) {
+	column := func(name, columnType string) *models.Column {
+		return &models.Column{Name: util.NewCaseString(name), Type: columnType}
+	}
+	writer := &dbRowWriter{
+		defines: newTableMaps(&models.Models{Tables: []*models.Table{{
+			Name: util.NewCaseString("item"),
+			Columns: []*models.Column{
+				column("id", "bigint"),
+				column("flags", "bit(8)"),
+				column("price", "decimal(10,2)"),
+				column("rate", "decimal(5,0)"),
+				column("name", "varchar(64)"),
+				column("memo", "varchar(64)"),
+			},
+		}}}),
+		summary:     &dbLoadSummary{Name: "item"},
+		keys:        []string{"id", "flags", "price", "rate", "name", "memo"},
+		expressions: map[string]interface{}{},
+	}
+	writer.differ = newRowDiffer("item", writer.keys, []string{"id"})
+
+	// mysqlから読み込んだ値
+	old := []sql.NullString{{String: "1", Valid: true}, {String: "\x02", Valid: true}, {String: "1.50", Valid: true}, {String: "3", Valid: true}, {String: "null", Valid: true}, {}}
+	row := make(DBRow, 0)
+	for i, v := range old {
+		row = append(row, writer.toSyncValue(writer.keys[i], v))
+	}
+	writer.differ.AddOld(row)
+
+	// データの値(WriteRowと同じ変換)
+	toDBRow := func(values ...DBValue) DBRow {
+		res := make(DBRow, 0)
+		for i, v := range values {
+			res = append(res, writer.toDBValue(writer.keys[i], v))
+		}
+		return res
+	}
+	if change := writer.differ.Diff(toDBRow("1", "0b10", "1.5", "3", `\\null`, "null")); change != nil {
+		t.Errorf("unchanged row: got %+v", change)
+	}
+
+	writer.differ = newRowDiffer("item", writer.keys, []string{"id"})
+	writer.differ.AddOld(row)
+	change := writer.differ.Diff(toDBRow("1", "3", "1.25", "3", `\\null`, "null"))
+	if change == nil || !reflect.DeepEqual(change.Columns, []int{1, 2}) {
+		t.Fatalf("changed row: got %+v", change)
+	}
+	if got := writer.toSyncArg("flags", change.New[1]); got != uint64(3) {
+		t.Errorf("bit arg: got %#v", got)
+	}
+	if got := writer.toSyncArg("price", change.New[2]); got != "1.25" {
+		t.Errorf("decimal arg: got %#v", got)
+	}
+}
+
+func TestPadDecimalScale(t *testing.T) {
+	cases := []struct {
+		columnType string
+		v          string
+		want       string
+	}{
+		{"decimal(10,2)", "1.5", "1.50"},
+		{"decimal(10,2)", "1", "1.00"},
+		{"decimal(10, 2)", "-1.234", "-1.234"},
+		{"decimal(10,0)", "1", "1"},
+		{"decimal(10,2)", "1e3", "1e3"},
+		{"decimal", "1.5", "1.5"},
+		{"double", "1.5", "1.5"},
+	}
+	for _, c := range cases {
+		if got := padDecimalScale(&models.Column{Type: c.columnType}, c.v); got != c.want {
+			t.Errorf("%s %q: got %q, want %q", c.columnType, c.v, got, c.want)
+		}
+	}
+}
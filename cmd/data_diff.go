@@ -0,0 +1,317 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+	"github.com/alfalfalfa/mysql_tool/util/copy"
+	"github.com/docopt/docopt-go"
+)
+
+const usageDataDiff = `mysql_tool data-diff
+    データの差分をDML(INSERT, UPDATE, DELETE)で出力(マイグレーション用)
+
+Usage:
+    mysql_tool data-diff -h | --help
+    mysql_tool data-diff --old OLD... --defines DEFINES... [-f FORMAT] [-o OUTPUT] [--tables TABLES...] [--ignore-tables IGNORE_TABLES...] [--no-header] [--null NULL] INPUTS...
+
+Arg:
+    入力ファイルパス（json,yaml,xlsx,csv,tsv,dir） | mysql dsn(https://github.com/go-sql-driver/mysql#dsn-data-source-name)
+
+Options:
+    -h --help                             Show this screen.
+    --old=OLD...                          比較元のデータ(入力ファイルパス | mysql dsn)
+    --defines=DEFINES...                  DB定義ファイル(行は主キーで突き合わせる)
+    -f FORMAT, --format=FORMAT            出力フォーマット [default: goose]
+        "sql"
+            差分のDMLを出力
+        "goose"
+            goose-up, goose-downを出力
+    -o OUTPUT, --output=OUTPUT            出力先
+        ディレクトリ
+            日付からファイル名生成
+        ファイルパス
+            上書き
+        none
+            標準出力
+    --tables=TABLES...                    対象テーブル
+    --ignore-tables=IGNORE_TABLES...      無視テーブル
+    --no-header                           csv, tsvの1行目をヘッダーとしない(カラムは--definesの定義順)
+    --null=NULL                           csv, tsvのnullの値 [default: \N]
+
+Statements:
+    Up: DELETE(参照元テーブルが先), UPDATE(変更されたカラムのみ), INSERT(参照先テーブルが先)
+    Down: Upの逆(追加した行のDELETE, 変更前の値へのUPDATE, 削除した行のINSERT)
+    比較は両方のデータにあるカラムのみ(片方のみのカラムは標準エラー出力に警告)
+`
+
+type DataDiffArg struct {
+	Old          []string `arg:"--old"`
+	Defines      []string `arg:"--defines"`
+	Format       string   `arg:"--format"`
+	Output       string   `arg:"--output"`
+	Inputs       []string `arg:"INPUTS"`
+	Tables       []string `arg:"--tables"`
+	IgnoreTables []string `arg:"--ignore-tables"`
+	NoHeader     bool     `arg:"--no-header"`
+	Null         string   `arg:"--null"`
+}
+
+// テーブル毎のデータの差分
+type tableDataDiff struct {
+	Name    string
+	Keys    []string
+	OldKeys []string
+	differ  *rowDiffer
+	defines *tableMaps
+	// 比較するカラム(differのカラム)
+	commonKeys []string
+	Inserts    []DBRow
+	Updates    []*rowChange
+	Deletes    []DBRow
+}
+
+func RunDataDiff() {
+	arguments, err := docopt.Parse(usageDataDiff, os.Args[1:], true, "", false)
+	checkError(err)
+	arg := &DataDiffArg{}
+	copy.MapToStructWithTag(arguments, arg, "arg")
+	if arg.Format != "sql" && arg.Format != "goose" {
+		panic(fmt.Sprint("output format invalid:", arg.Format))
+	}
+
+	m := models.LoadModel(arg.IgnoreTables, arg.Defines...)
+	defines := newTableMaps(m)
+	newData := loadData(arg.toDataArg(arg.Inputs))
+	oldData := loadData(arg.toDataArg(arg.Old))
+
+	diffs := diffData(defines, newData, oldData)
+	order := make([]*tableDataDiff, 0)
+	for _, t := range models.SortTablesByDependency(m.Tables).Tables {
+		for _, d := range diffs {
+			if strings.ToLower(d.Name) == t.Name.Lower() {
+				order = append(order, d)
+			}
+		}
+	}
+
+	alter, revert := toDataDiffSQL(order)
+	output := formatMigration(arg.Format, alter, revert)
+	if output == "" {
+		return
+	}
+	writeDiffOutput(output, arg.Output, arg.Format+"_data.sql")
+}
+
+func (this *DataDiffArg) toDataArg(inputs []string) *DataArg {
+	return &DataArg{
+		Inputs:       inputs,
+		Tables:       this.Tables,
+		IgnoreTables: this.IgnoreTables,
+		Defines:      this.Defines,
+		NoHeader:     this.NoHeader,
+		Null:         this.Null,
+	}
+}
+
+// テーブル毎の差分(差分のないテーブルは含まない)
+func diffData(defines *tableMaps, newData, oldData *Data) []*tableDataDiff {
+	newTables := mergeTableData(newData)
+	oldTables := mergeTableData(oldData)
+	names := make([]string, 0)
+	for _, t := range newTables {
+		names = append(names, t.Name)
+	}
+	for _, t := range oldTables {
+		if findTableData(newTables, t.Name) == nil {
+			names = append(names, t.Name)
+		}
+	}
+
+	res := make([]*tableDataDiff, 0)
+	for _, name := range names {
+		if !defines.ContainsTable(strings.ToLower(name)) {
+			panic(fmt.Sprintf("table not found in --defines: %s", name))
+		}
+		d := diffTableData(defines, name, findTableData(newTables, name), findTableData(oldTables, name))
+		if len(d.Inserts) != 0 || len(d.Updates) != 0 || len(d.Deletes) != 0 {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+func diffTableData(defines *tableMaps, name string, newTable, oldTable *TableData) *tableDataDiff {
+	if newTable == nil {
+		newTable = &TableData{Name: name, Keys: oldTable.Keys}
+	}
+	if oldTable == nil {
+		oldTable = &TableData{Name: name, Keys: newTable.Keys}
+	}
+	res := &tableDataDiff{
+		Name:       name,
+		Keys:       newTable.Keys,
+		OldKeys:    oldTable.Keys,
+		defines:    defines,
+		commonKeys: make([]string, 0),
+		Inserts:    make([]DBRow, 0),
+		Updates:    make([]*rowChange, 0),
+		Deletes:    make([]DBRow, 0),
+	}
+	for _, k := range newTable.Keys {
+		if indexOfKey(oldTable.Keys, k) < 0 {
+			fmt.Fprintf(os.Stderr, "warning: column only in new data is not compared: %s.%s\n", name, k)
+			continue
+		}
+		res.commonKeys = append(res.commonKeys, k)
+	}
+	for _, k := range oldTable.Keys {
+		if indexOfKey(newTable.Keys, k) < 0 {
+			fmt.Fprintf(os.Stderr, "warning: column only in old data is not compared: %s.%s\n", name, k)
+		}
+	}
+
+	res.differ = newRowDiffer(name, res.commonKeys, defines.GetPrimaryKeyNames(strings.ToLower(name)))
+	oldRows := make(map[string]DBRow)
+	for _, row := range oldTable.Values {
+		row = toDataRow(defines, name, oldTable.Keys, row)
+		common := projectRow(row, oldTable.Keys, res.commonKeys)
+		res.differ.AddOld(common)
+		oldRows[res.differ.rowKey(normalizeDBRow(common))] = row
+	}
+	for _, row := range newTable.Values {
+		row = toDataRow(defines, name, newTable.Keys, row)
+		change := res.differ.Diff(projectRow(row, newTable.Keys, res.commonKeys))
+		if change == nil {
+			continue
+		}
+		if change.Type == rowChangeInsert {
+			res.Inserts = append(res.Inserts, normalizeDBRow(row))
+		} else {
+			res.Updates = append(res.Updates, change)
+		}
+	}
+	for _, change := range res.differ.Deleted() {
+		res.Deletes = append(res.Deletes, normalizeDBRow(oldRows[res.differ.rowKey(change.Old)]))
+	}
+	return res
+}
+
+/**
+Up: 削除(依存の逆順), 変更, 追加(依存順)
+Down: 追加した行の削除(依存の逆順), 変更前の値への変更, 削除した行の追加(依存順)
+*/
+func toDataDiffSQL(diffs []*tableDataDiff) (string, string) {
+	alter := bytes.NewBuffer(nil)
+	revert := bytes.NewBuffer(nil)
+	for i := len(diffs) - 1; 0 <= i; i-- {
+		d := diffs[i]
+		for _, row := range d.Deletes {
+			alter.WriteString(d.deleteSQL(projectRow(row, d.OldKeys, d.commonKeys)))
+		}
+		for _, row := range d.Inserts {
+			revert.WriteString(d.deleteSQL(projectRow(row, d.Keys, d.commonKeys)))
+		}
+	}
+	for _, d := range diffs {
+		for _, change := range d.Updates {
+			alter.WriteString(d.updateSQL(change.New, change.Columns))
+			revert.WriteString(d.updateSQL(change.Old, change.Columns))
+		}
+		alter.WriteString(d.insertSQL(d.Keys, d.Inserts))
+		revert.WriteString(d.insertSQL(d.OldKeys, d.Deletes))
+	}
+	return alter.String(), revert.String()
+}
+
+func (this *tableDataDiff) deleteSQL(row DBRow) string {
+	return "DELETE FROM `" + this.Name + "` WHERE " + this.primaryKeyCondition(row) + ";\n"
+}
+
+// rowはcommonKeysの値
+func (this *tableDataDiff) updateSQL(row DBRow, columns []int) string {
+	sets := make([]string, 0)
+	for _, i := range columns {
+		sets = append(sets, "`"+this.commonKeys[i]+"` = "+this.toSQLLiteral(this.commonKeys[i], row[i]))
+	}
+	return "UPDATE `" + this.Name + "` SET " + strings.Join(sets, ", ") + " WHERE " + this.primaryKeyCondition(row) + ";\n"
+}
+
+func (this *tableDataDiff) insertSQL(keys []string, rows []DBRow) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	values := make([]string, 0)
+	for _, row := range rows {
+		literals := make([]string, 0)
+		for i, v := range row {
+			literals = append(literals, this.toSQLLiteral(keys[i], v))
+		}
+		values = append(values, "("+strings.Join(literals, ",")+")")
+	}
+	return "INSERT INTO `" + this.Name + "` (" + strings.Join(quoteKeys(keys), ", ") + ") \nVALUES \n" + strings.Join(values, ",\n") + ";\n"
+}
+
+func (this *tableDataDiff) primaryKeyCondition(row DBRow) string {
+	conditions := make([]string, 0)
+	values := this.differ.PrimaryKeyValues(row)
+	for i, k := range this.differ.PrimaryKeyNames() {
+		conditions = append(conditions, "`"+k+"` = "+this.toSQLLiteral(k, values[i]))
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// toDataValueの値(--definesのカラムの型に合わせる)
+func (this *tableDataDiff) toSQLLiteral(key string, v DBValue) string {
+	return toColumnSQLLiteral(this.defines.GetColumn(strings.ToLower(this.Name), key), v)
+}
+
+func toDataRow(defines *tableMaps, tableName string, keys []string, row DBRow) DBRow {
+	res := make(DBRow, 0, len(row))
+	for i, v := range row {
+		res = append(res, toDataValue(defines, strings.ToLower(tableName), keys[i], v))
+	}
+	return res
+}
+
+// keysの行をtoKeysの並びにする
+func projectRow(row DBRow, keys []string, toKeys []string) DBRow {
+	res := make(DBRow, 0, len(toKeys))
+	for _, k := range toKeys {
+		index := indexOfKey(keys, k)
+		if index < 0 {
+			panic(fmt.Sprintf("column not found in data: %s (%s)", k, strings.Join(keys, ", ")))
+		}
+		res = append(res, row[index])
+	}
+	return res
+}
+
+// 同名テーブルのデータをまとめる(Excelの複数シートと同様)
+func mergeTableData(d *Data) []*TableData {
+	res := make([]*TableData, 0)
+	for _, t := range d.Tables {
+		exist := findTableData(res, t.Name)
+		if exist == nil {
+			res = append(res, &TableData{Name: t.Name, Keys: t.Keys, Values: t.Values, Sources: t.Sources})
+			continue
+		}
+		for _, row := range t.Values {
+			exist.Values = append(exist.Values, projectRow(row, t.Keys, exist.Keys))
+		}
+		exist.Sources = append(exist.Sources, t.Sources...)
+	}
+	return res
+}
+
+func findTableData(tables []*TableData, name string) *TableData {
+	for _, t := range tables {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+/**
+mysqlから読み込む行の条件(yaml)
+
+	seed: 1                         # --sampleの乱数のシード
+	tables:                         # テーブル名(glob)毎の条件、一致する全ての指定を順に適用(後の指定が優先、globよりテーブル名の指定が優先)
+	  - name: "*"
+	    limit: 1000
+	  - name: users
+	    where: "created_at >= '2024-01-01'"
+	    order_by: "id DESC"
+	    limit: 100
+	  - name: logs
+	    sample: "10%"
+
+	--where, --order-by, --limit, --sampleはファイルの指定より優先(--limit users:10 --limit 50 のusersは10)
+*/
+type dataFilter struct {
+	Seed   string             `yaml:"seed"`
+	Tables []*dataTableFilter `yaml:"tables"`
+}
+
+type dataTableFilter struct {
+	Name string `yaml:"name"`
+	// WHERE句の条件
+	Where string `yaml:"where"`
+	// ORDER BY句(limitの指定があり、ない場合は主キー順)
+	OrderBy string `yaml:"order_by"`
+	// 最大行数(0は無制限)
+	Limit int `yaml:"limit"`
+	// "10%": 各行を10%の確率で選ぶ, "100": ランダムに100行
+	Sample string `yaml:"sample"`
+	// 指定元(--filtersのファイル, --where等のオプション)
+	source string
+}
+
+// --filtersのファイルと--where, --order-by, --limit, --sample, --seed
+func loadDataFilter(arg *DataArg) *dataFilter {
+	res := &dataFilter{}
+	if arg.Filters != "" {
+		b, err := ioutil.ReadFile(arg.Filters)
+		checkError(err)
+		checkError(yaml.Unmarshal(b, res))
+		for _, t := range res.Tables {
+			if t.Name == "" {
+				panic(fmt.Sprintf("table name required in %s", arg.Filters))
+			}
+			_, err := path.Match(t.Name, "")
+			checkError(err)
+			t.source = arg.Filters
+		}
+	}
+
+	for _, where := range arg.Wheres {
+		name, v := splitTableOption("--where", where, true)
+		res.Tables = append(res.Tables, &dataTableFilter{Name: name, Where: v, source: "--where"})
+	}
+	for _, orderBy := range arg.OrderBys {
+		name, v := splitTableOption("--order-by", orderBy, true)
+		res.Tables = append(res.Tables, &dataTableFilter{Name: name, OrderBy: v, source: "--order-by"})
+	}
+	for _, limit := range arg.Limits {
+		name, v := splitTableOption("--limit", limit, false)
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			panic(fmt.Sprintf("--limit must be a positive number: %s", limit))
+		}
+		res.Tables = append(res.Tables, &dataTableFilter{Name: name, Limit: n, source: "--limit"})
+	}
+	for _, sample := range arg.Samples {
+		name, v := splitTableOption("--sample", sample, false)
+		res.Tables = append(res.Tables, &dataTableFilter{Name: name, Sample: v, source: "--sample"})
+	}
+	if arg.Seed != "" {
+		res.Seed = arg.Seed
+	}
+
+	if res.Seed != "" {
+		if _, err := strconv.ParseInt(res.Seed, 10, 64); err != nil {
+			panic(fmt.Sprintf("seed must be a number: %s", res.Seed))
+		}
+	}
+	for _, t := range res.Tables {
+		if t.Sample != "" {
+			parseSample(t.Sample)
+		}
+	}
+	return res
+}
+
+// TABLE:VALUE(requiredTableでなければVALUEのみで全テーブル)
+func splitTableOption(option, v string, requiredTable bool) (string, string) {
+	tmp := strings.SplitN(v, ":", 2)
+	if len(tmp) == 2 {
+		return tmp[0], tmp[1]
+	}
+	if requiredTable {
+		panic(fmt.Sprintf("%s must be TABLE:VALUE: %s", option, v))
+	}
+	return "*", v
+}
+
+// "10%"は割合(0.1), "100"は行数
+func parseSample(v string) (float64, int) {
+	if strings.HasSuffix(v, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		if err != nil || percent <= 0 || 100 < percent {
+			panic(fmt.Sprintf("sample percentage must be in (0, 100]: %s", v))
+		}
+		return percent / 100, 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		panic(fmt.Sprintf("sample must be a percentage or a positive number: %s", v))
+	}
+	return 0, n
+}
+
+func (this *dataFilter) IsEmpty() bool {
+	return len(this.Tables) == 0
+}
+
+// どのテーブルにも一致しない指定を警告する
+func (this *dataFilter) WarnUnmatched(w io.Writer, tableNames []string) {
+	for _, t := range this.Tables {
+		matched := false
+		for _, name := range tableNames {
+			if ok, _ := path.Match(t.Name, name); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fmt.Fprintf(w, "warning: table not matched: %s (%s)\n", t.Name, t.source)
+		}
+	}
+}
+
+/**
+テーブル名に一致する指定をまとめる(指定がない場合、thisがnilの場合はnil)
+	優先度の低い順(ファイルのglob, ファイルのテーブル名, オプションのglob, オプションのテーブル名)に適用
+*/
+func (this *dataFilter) Table(tableName string) *dataTableFilter {
+	if this == nil {
+		return nil
+	}
+	var res *dataTableFilter = nil
+	for priority := 0; priority < 4; priority++ {
+		for _, t := range this.Tables {
+			if t.priority() != priority {
+				continue
+			}
+			if ok, _ := path.Match(t.Name, tableName); !ok {
+				continue
+			}
+			if res == nil {
+				res = &dataTableFilter{Name: tableName}
+			}
+			res.merge(t)
+		}
+	}
+	return res
+}
+
+// Tableで適用する順
+func (this *dataTableFilter) priority() int {
+	res := 0
+	if strings.HasPrefix(this.source, "--") {
+		res += 2
+	}
+	if !strings.ContainsAny(this.Name, `*?[\`) {
+		res++
+	}
+	return res
+}
+
+func (this *dataTableFilter) merge(t *dataTableFilter) {
+	if t.Where != "" {
+		this.Where = t.Where
+	}
+	if t.OrderBy != "" {
+		this.OrderBy = t.OrderBy
+	}
+	if t.Limit != 0 {
+		this.Limit = t.Limit
+	}
+	if t.Sample != "" {
+		this.Sample = t.Sample
+	}
+}
+
+// RAND()またはRAND(seed)
+func (this *dataFilter) Rand() string {
+	return "RAND(" + this.Seed + ")"
+}
+
+/**
+SELECTの条件
+	where: WHERE (where)
+	sample 10%: WHERE RAND() < 0.1
+	sample 100: ORDER BY RAND() LIMIT 100
+	limit: ORDER BY order_by(ない場合は主キー) LIMIT limit
+primaryKeysは主キーの順序が必要な場合のみ呼び出す
+*/
+func (this *dataTableFilter) Query(rand string, primaryKeys func() []string) (where []string, orderBy string, limit int) {
+	where = make([]string, 0)
+	if this.Where != "" {
+		where = append(where, "("+this.Where+")")
+	}
+	orderBy = this.OrderBy
+	limit = this.Limit
+	if this.Sample != "" {
+		rate, rows := parseSample(this.Sample)
+		if rate != 0 {
+			where = append(where, rand+" < "+strconv.FormatFloat(rate, 'f', -1, 64))
+		} else {
+			orderBy = rand
+			if limit == 0 || rows < limit {
+				limit = rows
+			}
+		}
+	}
+	if limit != 0 && orderBy == "" {
+		orderBy = strings.Join(quoteKeys(primaryKeys()), ", ")
+	}
+	return where, orderBy, limit
+}
+
+// 進捗表示用の概算行数
+func (this *dataTableFilter) EstimateRows(rows int64) int64 {
+	if this.Sample != "" {
+		if rate, _ := parseSample(this.Sample); rate != 0 {
+			rows = int64(float64(rows) * rate)
+		}
+	}
+	if this.Limit != 0 && int64(this.Limit) < rows {
+		rows = int64(this.Limit)
+	}
+	if this.Sample != "" {
+		if _, n := parseSample(this.Sample); n != 0 && int64(n) < rows {
+			rows = int64(n)
+		}
+	}
+	return rows
+}
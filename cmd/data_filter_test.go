@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func expectPanic(t *testing.T, name string, f func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s: panic expected", name)
+		}
+	}()
+	f()
+}
+
+func TestSplitTableOption(t *testing.T) {
+	cases := []struct {
+		v             string
+		requiredTable bool
+		table, value  string
+	}{
+		{"users:id > 1", true, "users", "id > 1"},
+		{"users:a:b", true, "users", "a:b"},
+		{"log_*:100", false, "log_*", "100"},
+		{"100", false, "*", "100"},
+		{"10%", false, "*", "10%"},
+	}
+	for _, c := range cases {
+		table, value := splitTableOption("--where", c.v, c.requiredTable)
+		if table != c.table || value != c.value {
+			t.Errorf("%q: got (%q, %q), want (%q, %q)", c.v, table, value, c.table, c.value)
+		}
+	}
+	expectPanic(t, "no table", func() { splitTableOption("--where", "id > 1", true) })
+}
+
+func TestLoadDataFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "data_filter")
+	checkError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "filters.yml")
+	checkError(ioutil.WriteFile(path, []byte(`
+seed: 1
+tables:
+  - name: "*"
+    limit: 1000
+  - name: users
+    where: "created_at >= '2024-01-01'"
+    order_by: "id DESC"
+    limit: 100
+  - name: logs
+    sample: "10%"
+`), os.ModePerm))
+
+	filter := loadDataFilter(&DataArg{
+		Filters:  path,
+		Wheres:   []string{"users:deleted_at IS NULL"},
+		OrderBys: []string{"items:name"},
+		Limits:   []string{"users:10", "50"},
+		Samples:  []string{"logs:5"},
+		Seed:     "2",
+	})
+	if filter.Seed != "2" {
+		t.Errorf("seed: got %q", filter.Seed)
+	}
+	if filter.Rand() != "RAND(2)" {
+		t.Errorf("rand: got %q", filter.Rand())
+	}
+
+	cases := []struct {
+		table string
+		want  *dataTableFilter
+	}{
+		{"users", &dataTableFilter{Name: "users", Where: "deleted_at IS NULL", OrderBy: "id DESC", Limit: 10}},
+		{"logs", &dataTableFilter{Name: "logs", Limit: 50, Sample: "5"}},
+		{"items", &dataTableFilter{Name: "items", OrderBy: "name", Limit: 50}},
+	}
+	for _, c := range cases {
+		if got := filter.Table(c.table); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.table, got, c.want)
+		}
+	}
+
+	// ファイル, オプションのそれぞれでglobよりテーブル名の指定が優先
+	checkError(ioutil.WriteFile(path, []byte(`
+tables:
+  - name: users
+    limit: 100
+  - name: "*"
+    limit: 1000
+  - name: "user?"
+    where: "id > 1"
+`), os.ModePerm))
+	filter = loadDataFilter(&DataArg{Filters: path, Wheres: []string{"users:id > 2", "*:id > 3"}})
+	if got, want := filter.Table("users"), (&dataTableFilter{Name: "users", Where: "id > 2", Limit: 100}); !reflect.DeepEqual(got, want) {
+		t.Errorf("users: got %+v, want %+v", got, want)
+	}
+	if got, want := filter.Table("items"), (&dataTableFilter{Name: "items", Where: "id > 3", Limit: 1000}); !reflect.DeepEqual(got, want) {
+		t.Errorf("items: got %+v, want %+v", got, want)
+	}
+
+	if got := loadDataFilter(&DataArg{Limits: []string{"users:10"}}).Table("items"); got != nil {
+		t.Errorf("items: got %+v, want nil", got)
+	}
+	var empty *dataFilter
+	if got := empty.Table("users"); got != nil {
+		t.Errorf("nil filter: got %+v", got)
+	}
+	if !loadDataFilter(&DataArg{}).IsEmpty() {
+		t.Errorf("empty filter expected")
+	}
+
+	expectPanic(t, "limit 0", func() { loadDataFilter(&DataArg{Limits: []string{"0"}}) })
+	expectPanic(t, "limit not a number", func() { loadDataFilter(&DataArg{Limits: []string{"users:x"}}) })
+	expectPanic(t, "where without table", func() { loadDataFilter(&DataArg{Wheres: []string{"id > 1"}}) })
+	expectPanic(t, "sample 0%", func() { loadDataFilter(&DataArg{Samples: []string{"0%"}}) })
+	expectPanic(t, "sample over 100%", func() { loadDataFilter(&DataArg{Samples: []string{"101%"}}) })
+	expectPanic(t, "sample not a number", func() { loadDataFilter(&DataArg{Samples: []string{"x"}}) })
+	expectPanic(t, "seed not a number", func() { loadDataFilter(&DataArg{Seed: "x"}) })
+
+	checkError(ioutil.WriteFile(path, []byte("tables:\n  - limit: 1\n"), os.ModePerm))
+	expectPanic(t, "no table name", func() { loadDataFilter(&DataArg{Filters: path}) })
+	checkError(ioutil.WriteFile(path, []byte("tables:\n  - name: \"[\"\n"), os.ModePerm))
+	expectPanic(t, "bad pattern", func() { loadDataFilter(&DataArg{Filters: path}) })
+}
+
+func TestDataFilterWarnUnmatched(t *testing.T) {
+	filter := loadDataFilter(&DataArg{
+		Wheres: []string{"users:id > 1", "ghost:id > 1"},
+		Limits: []string{"log_*:10", "100"},
+	})
+	w := &bytes.Buffer{}
+	filter.WarnUnmatched(w, []string{"users", "items"})
+	want := "warning: table not matched: ghost (--where)\nwarning: table not matched: log_* (--limit)\n"
+	if w.String() != want {
+		t.Errorf("got %q, want %q", w.String(), want)
+	}
+}
+
+func TestDataTableFilterQuery(t *testing.T) {
+	primaryKeys := func() []string { return []string{"id", "sub_id"} }
+	noPrimaryKeys := func() []string {
+		t.Errorf("primary keys must not be loaded")
+		return nil
+	}
+	cases := []struct {
+		name        string
+		filter      *dataTableFilter
+		primaryKeys func() []string
+		where       []string
+		orderBy     string
+		limit       int
+	}{
+		{"empty", &dataTableFilter{}, noPrimaryKeys, []string{}, "", 0},
+		{"where", &dataTableFilter{Where: "a = 1 OR b = 2"}, noPrimaryKeys, []string{"(a = 1 OR b = 2)"}, "", 0},
+		{"order by", &dataTableFilter{OrderBy: "name"}, noPrimaryKeys, []string{}, "name", 0},
+		{"limit", &dataTableFilter{Limit: 10}, primaryKeys, []string{}, "`id`, `sub_id`", 10},
+		{"limit order by", &dataTableFilter{OrderBy: "id DESC", Limit: 10}, noPrimaryKeys, []string{}, "id DESC", 10},
+		{"sample rate", &dataTableFilter{Where: "a = 1", Sample: "10%"}, noPrimaryKeys, []string{"(a = 1)", "RAND(1) < 0.1"}, "", 0},
+		{"sample rate limit", &dataTableFilter{Sample: "50%", Limit: 5}, primaryKeys, []string{"RAND(1) < 0.5"}, "`id`, `sub_id`", 5},
+		{"sample rows", &dataTableFilter{OrderBy: "name", Sample: "100"}, noPrimaryKeys, []string{}, "RAND(1)", 100},
+		{"sample rows under limit", &dataTableFilter{Sample: "100", Limit: 1000}, noPrimaryKeys, []string{}, "RAND(1)", 100},
+		{"sample rows over limit", &dataTableFilter{Sample: "100", Limit: 10}, noPrimaryKeys, []string{}, "RAND(1)", 10},
+	}
+	for _, c := range cases {
+		where, orderBy, limit := c.filter.Query("RAND(1)", c.primaryKeys)
+		if !reflect.DeepEqual(where, c.where) || orderBy != c.orderBy || limit != c.limit {
+			t.Errorf("%s: got (%q, %q, %d), want (%q, %q, %d)", c.name, where, orderBy, limit, c.where, c.orderBy, c.limit)
+		}
+	}
+}
+
+func TestDataTableFilterEstimateRows(t *testing.T) {
+	cases := []struct {
+		filter *dataTableFilter
+		rows   int64
+		want   int64
+	}{
+		{&dataTableFilter{}, 1000, 1000},
+		{&dataTableFilter{Limit: 10}, 1000, 10},
+		{&dataTableFilter{Limit: 10000}, 1000, 1000},
+		{&dataTableFilter{Sample: "10%"}, 1000, 100},
+		{&dataTableFilter{Sample: "10%", Limit: 50}, 1000, 50},
+		{&dataTableFilter{Sample: "100"}, 1000, 100},
+		{&dataTableFilter{Sample: "100"}, 10, 10},
+		{&dataTableFilter{Sample: "100", Limit: 20}, 1000, 20},
+	}
+	for _, c := range cases {
+		if got := c.filter.EstimateRows(c.rows); got != c.want {
+			t.Errorf("%+v rows %d: got %d, want %d", c.filter, c.rows, got, c.want)
+		}
+	}
+}
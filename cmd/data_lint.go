@@ -0,0 +1,502 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+	"github.com/alfalfalfa/mysql_tool/util/copy"
+	"github.com/docopt/docopt-go"
+)
+
+const usageDataLint = `mysql_tool data-lint
+    データをDB定義で検査(エラーがあれば終了コード1)
+
+Usage:
+    mysql_tool data-lint -h | --help
+    mysql_tool data-lint --defines DEFINES... [--tables TABLES...] [--ignore-tables IGNORE_TABLES...] [--no-header] [--null NULL] INPUTS...
+
+Arg:
+    入力ファイルパス（json,yaml,xlsx,csv,tsv,dir） | mysql dsn(https://github.com/go-sql-driver/mysql#dsn-data-source-name)
+
+Options:
+    -h --help                             Show this screen.
+    --defines=DEFINES...                  DB定義ファイル
+    --tables=TABLES...                    対象テーブル
+    --ignore-tables=IGNORE_TABLES...      無視テーブル
+    --no-header                           csv, tsvの1行目をヘッダーとしない(カラムは--definesの定義順)
+    --null=NULL                           csv, tsvのnullの値 [default: \N]
+
+Checks:
+    テーブル, カラムが--definesにあるか(NOT NULLでデフォルト値のないカラムがデータにない場合もエラー)
+    値の型, 範囲, 長さ(値はdataの--definesと同じく型に合わせた値、空の値はデフォルト値)
+    NOT NULL
+    主キー, ユニークキーの重複(同名のシート, ファイルをまとめたテーブル全体、NULLを含むキーは除く)
+    外部キーの参照先の値が読み込んだデータにあるか(参照先のテーブルがない場合は検査しない)
+    文字列のキーは大文字小文字, 末尾の空白を区別しない(_ci照合順序と同じ)
+    エラーはファイル, シート, 行毎に出力
+
+Exit status:
+    0  エラーなし
+    1  エラーあり
+    2  実行エラー
+`
+
+type DataLintArg struct {
+	Defines      []string `arg:"--defines"`
+	Inputs       []string `arg:"INPUTS"`
+	Tables       []string `arg:"--tables"`
+	IgnoreTables []string `arg:"--ignore-tables"`
+	NoHeader     bool     `arg:"--no-header"`
+	Null         string   `arg:"--null"`
+}
+
+// 検査エラー
+type dataLintError struct {
+	Source  DataSource
+	Message string
+}
+
+func (this dataLintError) String() string {
+	return this.Source.String() + ": " + this.Message
+}
+
+func RunDataLint() {
+	arguments, err := docopt.Parse(usageDataLint, os.Args[1:], true, "", false)
+	checkError(err)
+	arg := &DataLintArg{}
+	copy.MapToStructWithTag(arguments, arg, "arg")
+
+	dataArg := &DataArg{
+		Inputs:       arg.Inputs,
+		Tables:       arg.Tables,
+		IgnoreTables: arg.IgnoreTables,
+		Defines:      arg.Defines,
+		NoHeader:     arg.NoHeader,
+		Null:         arg.Null,
+	}
+	errors := lintData(loadModelToMap(dataArg), loadData(dataArg))
+	if len(errors) == 0 {
+		fmt.Println("no error")
+		return
+	}
+	printDataLintErrors(os.Stdout, errors)
+	os.Exit(1)
+}
+
+func printDataLintErrors(w io.Writer, errors []dataLintError) {
+	for _, e := range errors {
+		fmt.Fprintln(w, e.String())
+	}
+	fmt.Fprintf(w, "%d errors\n", len(errors))
+}
+
+// 主キー, ユニークキーの値毎の最初の行
+type dataLintKey struct {
+	name    string
+	columns []*models.Column
+	seen    map[string]DataSource
+}
+
+// 外部キー(参照先は全テーブルの検査後に確認)
+type dataLintReference struct {
+	source DataSource
+	column *models.Column
+	to     *models.Column
+	value  string
+}
+
+/**
+データを--definesで検査する
+	同名のテーブルは全体で主キー, ユニークキーの重複を検査する
+	外部キーは全テーブルの読み込み後に検査する
+*/
+func lintData(defines *tableMaps, d *Data) []dataLintError {
+	res := make([]dataLintError, 0)
+	keys := make(map[string][]*dataLintKey)
+	// 参照されるカラムの値(テーブル名.カラム名)
+	referenced := make(map[string]map[string]bool)
+	references := make([]dataLintReference, 0)
+
+	for _, t := range d.Tables {
+		tableName := strings.ToLower(t.Name)
+		tableSource := DataSource{Sheet: t.Name}
+		if 0 < len(t.Values) {
+			tableSource = t.Source(0)
+			tableSource.Row = 0
+		}
+		if !defines.ContainsTable(tableName) {
+			res = append(res, dataLintError{tableSource, "table not found in --defines: " + t.Name})
+			continue
+		}
+		table := defines.Tables[tableName]
+
+		columns := make([]*models.Column, 0, len(t.Keys))
+		for _, k := range t.Keys {
+			col := defines.GetColumn(tableName, k)
+			if col == nil {
+				res = append(res, dataLintError{tableSource, "column not found in --defines: " + k})
+			}
+			columns = append(columns, col)
+		}
+		for _, col := range table.Columns {
+			if indexOfKey(t.Keys, col.Name.LowerSnake()) < 0 && col.NotNull && !col.Default.Valid && !isAutoIncrement(col) {
+				res = append(res, dataLintError{tableSource, "NOT NULL column without default not found in data: " + col.Name.LowerSnake()})
+			}
+		}
+
+		if _, ok := keys[tableName]; !ok {
+			keys[tableName] = newDataLintKeys(table)
+		}
+		for _, col := range table.Columns {
+			if len(col.InverseReferences) != 0 {
+				if _, ok := referenced[referenceName(col)]; !ok {
+					referenced[referenceName(col)] = make(map[string]bool)
+				}
+			}
+		}
+
+		for i, row := range t.Values {
+			source := t.Source(i)
+			values := make(map[*models.Column]DBValue)
+			for j, rawV := range row {
+				col := columns[j]
+				if col == nil {
+					continue
+				}
+				v := toColumnValue(col, rawV)
+				values[col] = v
+				// 値のエラーとは別に参照先の値は記録する(参照元の参照エラーを重ねて出さない)
+				s, isString := v.(string)
+				if set, ok := referenced[referenceName(col)]; ok && isString {
+					set[lintKeyValue(col, s)] = true
+				}
+				if message := lintColumnValue(col, v); message != "" {
+					res = append(res, dataLintError{source, col.Name.LowerSnake() + ": " + message})
+					continue
+				}
+				if isString {
+					for _, ref := range col.References {
+						references = append(references, dataLintReference{source, col, ref.To.Column, s})
+					}
+				}
+			}
+			for _, key := range keys[tableName] {
+				if message := key.Add(values, source); message != "" {
+					res = append(res, dataLintError{source, message})
+				}
+			}
+		}
+	}
+
+	warned := make(map[string]bool)
+	for _, ref := range references {
+		set, ok := referenced[referenceName(ref.to)]
+		if !ok {
+			// 参照先のデータがない場合は検査しない
+			if !warned[referenceName(ref.to)] {
+				fmt.Fprintf(os.Stderr, "warning: referenced table not in data, foreign key is not checked: %s\n", ref.column.Reference)
+				warned[referenceName(ref.to)] = true
+			}
+			continue
+		}
+		if !set[lintKeyValue(ref.to, ref.value)] {
+			res = append(res, dataLintError{ref.source, fmt.Sprintf("%s: foreign key %s not found: %q", ref.column.Name.LowerSnake(), ref.column.Reference, ref.value)})
+		}
+	}
+	return res
+}
+
+func referenceName(col *models.Column) string {
+	return col.Table.Name.Lower() + "." + col.Name.LowerSnake()
+}
+
+func isAutoIncrement(col *models.Column) bool {
+	return strings.Contains(strings.ToUpper(col.Extra), "AUTO_INCREMENT")
+}
+
+func newDataLintKeys(table *models.Table) []*dataLintKey {
+	res := make([]*dataLintKey, 0)
+	if len(table.PrimaryKeys) != 0 {
+		res = append(res, &dataLintKey{name: "primary key", columns: table.PrimaryKeys, seen: make(map[string]DataSource)})
+	}
+	for _, index := range table.Indexes {
+		if !index.Unique {
+			continue
+		}
+		res = append(res, &dataLintKey{name: "unique key " + index.Name, columns: index.Columns, seen: make(map[string]DataSource)})
+	}
+	return res
+}
+
+// 重複した場合はエラーメッセージ(NULL, 空のAUTO_INCREMENTまたはデータにないカラムを含むキーは検査しない)
+func (this *dataLintKey) Add(values map[*models.Column]DBValue, source DataSource) string {
+	keyValues := make([]string, 0, len(this.columns))
+	for _, col := range this.columns {
+		s, ok := values[col].(string)
+		if !ok || s == "" && isAutoIncrement(col) {
+			return ""
+		}
+		keyValues = append(keyValues, strconv.Quote(lintKeyValue(col, s)))
+	}
+	key := "(" + strings.Join(keyValues, ",") + ")"
+	if first, ok := this.seen[key]; ok {
+		return fmt.Sprintf("duplicate %s %s (first: %s)", this.name, key, first.String())
+	}
+	this.seen[key] = source
+	return ""
+}
+
+// キーの比較用の値
+func lintKeyValue(col *models.Column, v string) string {
+	t := parseColumnType(col)
+	switch columnValueType(col) {
+	case columnValueNumber, columnValueBool:
+		if n, ok := new(big.Rat).SetString(v); ok {
+			return n.RatString()
+		}
+	case columnValueString:
+		if t.Name == "json" || t.Name == "enum" || t.Name == "set" || strings.Contains(strings.ToLower(col.Table.DefaultCollation), "_bin") {
+			return v
+		}
+		return strings.ToLower(strings.TrimRight(v, " "))
+	}
+	return v
+}
+
+// 型名, 引数, unsigned
+type columnType struct {
+	Name     string
+	Args     []string
+	Unsigned bool
+}
+
+var columnTypeRegexp = regexp.MustCompile("^([a-z]+)\\s*(\\((.*)\\))?(.*)$")
+
+func parseColumnType(col *models.Column) columnType {
+	m := columnTypeRegexp.FindStringSubmatch(strings.ToLower(strings.TrimSpace(col.Type)))
+	if m == nil {
+		return columnType{Name: strings.ToLower(col.Type)}
+	}
+	res := columnType{Name: m[1], Args: make([]string, 0), Unsigned: strings.Contains(m[4], "unsigned")}
+	if m[3] != "" {
+		for _, arg := range splitTypeArgs(m[3]) {
+			res.Args = append(res.Args, strings.TrimSpace(arg))
+		}
+	}
+	return res
+}
+
+// カンマ区切り(クォート内のカンマは区切らない)
+func splitTypeArgs(v string) []string {
+	res := make([]string, 0)
+	quoted := false
+	start := 0
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '\'':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				res = append(res, v[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(res, v[start:])
+}
+
+func (this columnType) IntArg(i int, defaultValue int) int {
+	if len(this.Args) <= i {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(this.Args[i])
+	if err != nil {
+		return defaultValue
+	}
+	return n
+}
+
+// enum, setの値
+func (this columnType) Values() []string {
+	res := make([]string, 0, len(this.Args))
+	for _, arg := range this.Args {
+		res = append(res, strings.Replace(strings.Trim(arg, "'"), "''", "'", -1))
+	}
+	return res
+}
+
+// 整数型のビット数
+var integerTypeBits = map[string]int{
+	"tinyint":   8,
+	"smallint":  16,
+	"mediumint": 24,
+	"int":       32,
+	"integer":   32,
+	"bigint":    64,
+	"bool":      8,
+	"boolean":   8,
+}
+
+// 文字列型の最大バイト数
+var textTypeBytes = map[string]int{
+	"tinytext":   255,
+	"text":       65535,
+	"mediumtext": 16777215,
+	"longtext":   4294967295,
+	"tinyblob":   255,
+	"blob":       65535,
+	"mediumblob": 16777215,
+	"longblob":   4294967295,
+}
+
+var timeValueRegexp = regexp.MustCompile("^-?[0-9]{1,3}:[0-9]{2}(:[0-9]{2}(\\.[0-9]{1,6})?)?$")
+
+/**
+toColumnValueの値を検査する(エラーがない場合は空)
+	nilはNOT NULL(AUTO_INCREMENTは除く)、式のデフォルト値は検査しない
+*/
+func lintColumnValue(col *models.Column, v DBValue) string {
+	if v == nil {
+		if col.NotNull && !isAutoIncrement(col) {
+			return "null in NOT NULL column"
+		}
+		return ""
+	}
+	s, ok := v.(string)
+	if !ok {
+		return ""
+	}
+	if s == "" && isAutoIncrement(col) {
+		return ""
+	}
+	t := parseColumnType(col)
+	if bits, ok := integerTypeBits[t.Name]; ok {
+		return lintIntegerValue(s, bits, t.Unsigned)
+	}
+	switch t.Name {
+	case "decimal", "numeric", "dec", "fixed":
+		if !numberValueRegexp.MatchString(s) {
+			return fmt.Sprintf("not a number: %q", s)
+		}
+		// 整数部の桁数(小数部は丸められる)
+		precision, scale := t.IntArg(0, 10), t.IntArg(1, 0)
+		if r, ok := new(big.Rat).SetString(s); ok {
+			digits := len(strings.TrimLeft(new(big.Int).Quo(new(big.Int).Abs(r.Num()), r.Denom()).String(), "0"))
+			if precision-scale < digits || t.Unsigned && r.Sign() < 0 {
+				return fmt.Sprintf("out of range for %s: %q", col.Type, s)
+			}
+		}
+	case "float", "double", "real":
+		if !numberValueRegexp.MatchString(s) {
+			return fmt.Sprintf("not a number: %q", s)
+		}
+		if t.Unsigned && strings.HasPrefix(s, "-") {
+			return fmt.Sprintf("out of range for %s: %q", col.Type, s)
+		}
+	case "year":
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Sprintf("not a year: %q", s)
+		}
+		if !(0 <= n && n <= 99 || 1901 <= n && n <= 2155) {
+			return fmt.Sprintf("out of range for %s: %q", col.Type, s)
+		}
+	case "bit":
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fmt.Sprintf("not a bit value: %q", s)
+		}
+		if bits := t.IntArg(0, 1); bits < 64 && n>>uint(bits) != 0 {
+			return fmt.Sprintf("out of range for %s: %q", col.Type, s)
+		}
+	case "char", "varchar":
+		if max := t.IntArg(0, 1); max < utf8.RuneCountInString(s) {
+			return fmt.Sprintf("too long (%d > %d characters)", utf8.RuneCountInString(s), max)
+		}
+	case "binary", "varbinary":
+		if max := t.IntArg(0, 1); max < len(s) {
+			return fmt.Sprintf("too long (%d > %d bytes)", len(s), max)
+		}
+	case "date", "datetime", "timestamp":
+		return lintTimeValue(col, t, s)
+	case "time":
+		if !timeValueRegexp.MatchString(s) {
+			return fmt.Sprintf("not a time: %q", s)
+		}
+	case "enum":
+		if !containsFold(t.Values(), s) {
+			return fmt.Sprintf("not in %s: %q", col.Type, s)
+		}
+	case "set":
+		if s != "" {
+			for _, item := range strings.Split(s, ",") {
+				if !containsFold(t.Values(), item) {
+					return fmt.Sprintf("not in %s: %q", col.Type, s)
+				}
+			}
+		}
+	case "json":
+		if !json.Valid([]byte(s)) {
+			return fmt.Sprintf("invalid json: %q", s)
+		}
+	default:
+		if max, ok := textTypeBytes[t.Name]; ok && max < len(s) {
+			return fmt.Sprintf("too long (%d > %d bytes)", len(s), max)
+		}
+	}
+	return ""
+}
+
+func lintIntegerValue(s string, bits int, unsigned bool) string {
+	n, ok := new(big.Int).SetString(strings.TrimPrefix(s, "+"), 10)
+	if !ok {
+		return fmt.Sprintf("not an integer: %q", s)
+	}
+	min := new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), uint(bits-1)))
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(bits-1)), big.NewInt(1))
+	if unsigned {
+		min = big.NewInt(0)
+		max = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(bits)), big.NewInt(1))
+	}
+	if n.Cmp(min) < 0 || 0 < n.Cmp(max) {
+		return fmt.Sprintf("out of range (%s..%s): %q", min, max, s)
+	}
+	return ""
+}
+
+func lintTimeValue(col *models.Column, t columnType, s string) string {
+	// ゼロ日付はsql_modeに依存するため検査しない
+	if strings.HasPrefix(s, "0000-00-00") {
+		return ""
+	}
+	layout := "2006-01-02 15:04:05.999999"
+	if t.Name == "date" {
+		layout = "2006-01-02"
+	}
+	v, err := time.Parse(layout, s)
+	if err != nil {
+		return fmt.Sprintf("not a %s: %q", t.Name, s)
+	}
+	if t.Name == "timestamp" && (v.Before(time.Date(1970, 1, 1, 0, 0, 1, 0, time.UTC)) || v.After(time.Date(2038, 1, 19, 3, 14, 7, 999999000, time.UTC))) {
+		return fmt.Sprintf("out of range for %s: %q", col.Type, s)
+	}
+	return ""
+}
+
+func containsFold(s []string, e string) bool {
+	for _, a := range s {
+		if strings.EqualFold(a, e) {
+			return true
+		}
+	}
+	return false
+}
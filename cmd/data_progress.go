@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// 進捗の出力間隔
+const dataProgressInterval = time.Second
+
+// テーブル毎の出力行数(総行数はinformation_schemaの概算値)
+type dataProgress struct {
+	Rows int64
+
+	w        io.Writer
+	name     string
+	estimate int64
+	start    time.Time
+	last     time.Time
+}
+
+func newDataProgress(w io.Writer, name string, estimate int64) *dataProgress {
+	now := time.Now()
+	return &dataProgress{
+		w:        w,
+		name:     name,
+		estimate: estimate,
+		start:    now,
+		last:     now,
+	}
+}
+
+func (this *dataProgress) Add(n int64) {
+	this.Rows += n
+	if now := time.Now(); dataProgressInterval <= now.Sub(this.last) {
+		this.last = now
+		this.print("")
+	}
+}
+
+func (this *dataProgress) Done() {
+	this.print(fmt.Sprintf(" done (%s)", time.Since(this.start).Round(time.Millisecond)))
+}
+
+func (this *dataProgress) print(suffix string) {
+	if 0 < this.estimate {
+		fmt.Fprintf(this.w, "%s: %d/~%d rows%s\n", this.name, this.Rows, this.estimate, suffix)
+	} else {
+		fmt.Fprintf(this.w, "%s: %d rows%s\n", this.name, this.Rows, suffix)
+	}
+}
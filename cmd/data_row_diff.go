@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 行の差分の種類
+const (
+	rowChangeInsert = "insert"
+	rowChangeUpdate = "update"
+	rowChangeDelete = "delete"
+)
+
+// 主キーで突き合わせた行の差分
+type rowChange struct {
+	Type string
+	// 変更前(insertではnil)
+	Old DBRow
+	// 変更後(deleteではnil)
+	New DBRow
+	// 変更されたカラムの位置(update)
+	Columns []int
+}
+
+/**
+主キーで行を突き合わせて差分を求める
+	AddOldで変更前の行を全て追加した後、変更後の行毎にDiff、最後にDeleted
+	値はnormalizeDBValueで比較する(nil, 文字列またはsqlExpression)
+	変更前の行のみメモリに保持する
+*/
+type rowDiffer struct {
+	table     string
+	keys      []string
+	pkIndexes []int
+	old       map[string]DBRow
+	oldOrder  []string
+	seen      map[string]bool
+}
+
+func newRowDiffer(table string, keys []string, pk []string) *rowDiffer {
+	if len(pk) == 0 {
+		panic(fmt.Sprintf("primary key not found: %s", table))
+	}
+	res := &rowDiffer{
+		table:     table,
+		keys:      keys,
+		pkIndexes: make([]int, 0),
+		old:       make(map[string]DBRow),
+		oldOrder:  make([]string, 0),
+		seen:      make(map[string]bool),
+	}
+	for _, name := range pk {
+		index := indexOfKey(keys, name)
+		if index < 0 {
+			panic(fmt.Sprintf("primary key column not found in data: %s.%s", table, name))
+		}
+		res.pkIndexes = append(res.pkIndexes, index)
+	}
+	return res
+}
+
+func (this *rowDiffer) AddOld(row DBRow) {
+	row = normalizeDBRow(row)
+	key := this.rowKey(row)
+	if _, ok := this.old[key]; ok {
+		panic(fmt.Sprintf("duplicate primary key: %s %s", this.table, key))
+	}
+	this.old[key] = row
+	this.oldOrder = append(this.oldOrder, key)
+}
+
+// 追加または変更された場合のみ差分を返す
+func (this *rowDiffer) Diff(row DBRow) *rowChange {
+	row = normalizeDBRow(row)
+	key := this.rowKey(row)
+	if this.seen[key] {
+		panic(fmt.Sprintf("duplicate primary key: %s %s", this.table, key))
+	}
+	this.seen[key] = true
+
+	old, ok := this.old[key]
+	if !ok {
+		return &rowChange{Type: rowChangeInsert, New: row}
+	}
+	columns := make([]int, 0)
+	for i := range row {
+		if !equalDBValue(old[i], row[i]) {
+			columns = append(columns, i)
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	return &rowChange{Type: rowChangeUpdate, Old: old, New: row, Columns: columns}
+}
+
+// 変更後に存在しない行(変更前の順)
+func (this *rowDiffer) Deleted() []*rowChange {
+	res := make([]*rowChange, 0)
+	for _, key := range this.oldOrder {
+		if !this.seen[key] {
+			res = append(res, &rowChange{Type: rowChangeDelete, Old: this.old[key]})
+		}
+	}
+	return res
+}
+
+// 主キーの値
+func (this *rowDiffer) PrimaryKeyValues(row DBRow) DBRow {
+	res := make(DBRow, 0, len(this.pkIndexes))
+	for _, i := range this.pkIndexes {
+		res = append(res, row[i])
+	}
+	return res
+}
+
+func (this *rowDiffer) PrimaryKeyNames() []string {
+	res := make([]string, 0, len(this.pkIndexes))
+	for _, i := range this.pkIndexes {
+		res = append(res, this.keys[i])
+	}
+	return res
+}
+
+func (this *rowDiffer) rowKey(row DBRow) string {
+	values := make([]string, 0, len(this.pkIndexes))
+	for _, v := range this.PrimaryKeyValues(row) {
+		if v == nil {
+			values = append(values, "null")
+		} else {
+			values = append(values, fmt.Sprintf("%q", v))
+		}
+	}
+	return "(" + strings.Join(values, ",") + ")"
+}
+
+func normalizeDBRow(row DBRow) DBRow {
+	res := make(DBRow, 0, len(row))
+	for _, v := range row {
+		res = append(res, normalizeDBValue(v))
+	}
+	return res
+}
+
+// 比較用の値(nil, 文字列またはsqlExpression)
+func normalizeDBValue(v DBValue) DBValue {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return t
+	case sqlExpression:
+		return t
+	case []byte:
+		return string(t)
+	case time.Time:
+		return t.Format("2006-01-02 15:04:05")
+	}
+	return ToString(v)
+}
+
+func equalDBValue(a, b DBValue) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a == b
+}
+
+func indexOfKey(keys []string, name string) int {
+	for i, k := range keys {
+		if strings.EqualFold(k, name) {
+			return i
+		}
+	}
+	return -1
+}
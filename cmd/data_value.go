@@ -0,0 +1,373 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+	"github.com/alfalfalfa/xlsx"
+)
+
+// 文字列"null"を表すセルの値("\null", "null"はNULL)、\を重ねた場合は\を1つ除いた文字列
+var escapedNullRegexp = regexp.MustCompile(`(?i)^\\+null$`)
+
+// SQLにそのまま出力する値(CURRENT_TIMESTAMPなどの式のデフォルト値)
+type sqlExpression string
+
+// --definesのカラムの型の分類
+const (
+	columnValueString = iota
+	columnValueNumber
+	columnValueBool
+	columnValueBit
+	columnValueBinary
+	columnValueDate
+	columnValueDateTime
+	columnValueTime
+)
+
+var (
+	columnTypeNumberRegexp   = regexp.MustCompile("^(tinyint|smallint|mediumint|int|integer|bigint|decimal|numeric|dec|fixed|float|double|real|year)")
+	columnTypeDecimalRegexp  = regexp.MustCompile("^(decimal|numeric|dec|fixed)\\([0-9]+,\\s*([0-9]+)\\)")
+	columnTypeBoolRegexp     = regexp.MustCompile("^(bool|boolean|tinyint\\(1\\))")
+	columnTypeBitRegexp      = regexp.MustCompile("^bit")
+	columnTypeBinaryRegexp   = regexp.MustCompile("^(binary|varbinary|tinyblob|blob|mediumblob|longblob)")
+	columnTypeDateRegexp     = regexp.MustCompile("^date$")
+	columnTypeDateTimeRegexp = regexp.MustCompile("^(datetime|timestamp)")
+	columnTypeTimeRegexp     = regexp.MustCompile("^time")
+
+	numberValueRegexp = regexp.MustCompile("^[-+]?([0-9]+\\.?[0-9]*|\\.[0-9]+)([eE][-+]?[0-9]+)?$")
+	// CURRENT_TIMESTAMP, NOW()などの式のデフォルト値
+	timeDefaultRegexp = regexp.MustCompile("^(?i)((CURRENT_TIMESTAMP|CURRENT_DATE|CURRENT_TIME|LOCALTIME|LOCALTIMESTAMP)(\\([0-9]*\\))?|(NOW|CURDATE|CURTIME|UTC_TIMESTAMP|UTC_DATE|UTC_TIME)\\([0-9]*\\))$")
+)
+
+// 日時として読み取る形式(Excelの表示形式を含む)
+var dateTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/1/2 15:04:05",
+	"2006/1/2 15:04",
+	"2006/1/2",
+	"20060102150405",
+	"20060102",
+	"01-02-06 15:04",
+	"01-02-06",
+	"1/2/06 15:04",
+	"1/2/06",
+	"15:04:05.999999999",
+	"15:04",
+}
+
+func columnValueType(col *models.Column) int {
+	t := strings.ToLower(strings.TrimSpace(col.Type))
+	switch {
+	case columnTypeBoolRegexp.MatchString(t):
+		return columnValueBool
+	case columnTypeNumberRegexp.MatchString(t):
+		return columnValueNumber
+	case columnTypeBitRegexp.MatchString(t):
+		return columnValueBit
+	case columnTypeBinaryRegexp.MatchString(t):
+		return columnValueBinary
+	case columnTypeDateRegexp.MatchString(t):
+		return columnValueDate
+	case columnTypeDateTimeRegexp.MatchString(t):
+		return columnValueDateTime
+	case columnTypeTimeRegexp.MatchString(t):
+		return columnValueTime
+	}
+	return columnValueString
+}
+
+/**
+データの値をカラムの型の値にする(nil, sqlExpression, 文字列)
+	"null"はnil、"\null"は文字列"null"
+	空の場合はデフォルト値(NULLまたはデフォルト値のないNULL可のカラムはnil、式はsqlExpression)
+	文字列はエスケープを解除して型毎の形式にする
+		数値: カンマを除く
+		bool: true/falseを1/0
+		bit: 10進数(b'101', 0b101, 0x1fも可)
+		binary: バイト列(0x..., X'...'は16進数)
+		date, datetime, timestamp, time: 2006-01-02 15:04:05の形式(Excelのシリアル値も可)
+	colがnilの場合は"null"とエスケープの解除のみ
+*/
+func toColumnValue(col *models.Column, rawV DBValue) DBValue {
+	switch t := rawV.(type) {
+	case nil:
+		return nil
+	case string:
+		if strings.ToLower(t) == "null" {
+			return nil
+		}
+		if u := unescapeValue(t); escapedNullRegexp.MatchString(u) {
+			return u[1:]
+		}
+		if col == nil {
+			return unescapeValue(t)
+		}
+		if t == "" {
+			return columnDefaultValue(col)
+		}
+		return canonicalColumnValue(col, unescapeValue(t))
+	case time.Time:
+		if col == nil {
+			return rawV
+		}
+		return formatColumnTime(col, t)
+	case []byte:
+		if col == nil {
+			return rawV
+		}
+		return canonicalColumnValue(col, string(t))
+	}
+	// mysqlから読み込んだ数値など
+	if col == nil {
+		return rawV
+	}
+	return canonicalColumnValue(col, ToString(rawV))
+}
+
+/**
+mysqlから読み込んだ生の文字列をデータの値(Excelのセルの値と同じ)にする
+	エスケープし、文字列"null"は"\null"
+*/
+func toDataString(v string) string {
+	if strings.EqualFold(v, "null") || escapedNullRegexp.MatchString(v) {
+		v = `\` + v
+	}
+	return escapeValue(v)
+}
+
+/**
+データの値を生の文字列にする(toDataStringの逆)
+	nullの場合はfalse
+*/
+func fromDataString(v DBValue) (string, bool) {
+	v = normalizeDBValue(v)
+	if v == nil {
+		return "", false
+	}
+	s := ToString(v)
+	if strings.EqualFold(s, "null") {
+		return "", false
+	}
+	s = unescapeValue(s)
+	if escapedNullRegexp.MatchString(s) {
+		s = s[1:]
+	}
+	return s, true
+}
+
+// 空の値の代わりのデフォルト値
+func columnDefaultValue(col *models.Column) DBValue {
+	if !col.Default.Valid {
+		if col.NotNull {
+			return ""
+		}
+		return nil
+	}
+	d := strings.TrimSpace(col.Default.ValueOrZero())
+	switch {
+	case strings.ToUpper(d) == "NULL":
+		return nil
+	case len(d) >= 2 && strings.HasPrefix(d, "'") && strings.HasSuffix(d, "'"):
+		return canonicalColumnValue(col, strings.Replace(d[1:len(d)-1], "''", "'", -1))
+	case isTimeColumnValue(col) && timeDefaultRegexp.MatchString(d),
+		strings.HasPrefix(d, "(") && strings.HasSuffix(d, ")"),
+		strings.Contains(strings.ToUpper(col.Extra), "DEFAULT_GENERATED"):
+		return sqlExpression(d)
+	}
+	return canonicalColumnValue(col, d)
+}
+
+func isTimeColumnValue(col *models.Column) bool {
+	switch columnValueType(col) {
+	case columnValueDate, columnValueDateTime, columnValueTime:
+		return true
+	}
+	return false
+}
+
+// 型毎の形式にする(読み取れない値はそのまま)
+func canonicalColumnValue(col *models.Column, v string) DBValue {
+	switch columnValueType(col) {
+	case columnValueNumber:
+		if n := strings.Replace(strings.TrimSpace(v), ",", "", -1); numberValueRegexp.MatchString(n) {
+			return n
+		}
+	case columnValueBool:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true":
+			return "1"
+		case "false":
+			return "0"
+		}
+		if n := strings.TrimSpace(v); numberValueRegexp.MatchString(n) {
+			return n
+		}
+	case columnValueBit:
+		if n, ok := parseBitValue(strings.TrimSpace(v)); ok {
+			return strconv.FormatUint(n, 10)
+		}
+	case columnValueBinary:
+		if b, ok := parseHexValue(strings.TrimSpace(v)); ok {
+			return string(b)
+		}
+	case columnValueDate, columnValueDateTime, columnValueTime:
+		if t, ok := parseTimeValue(strings.TrimSpace(v)); ok {
+			return formatColumnTime(col, t)
+		}
+	}
+	return v
+}
+
+// decimal(M,D)の小数部をD桁まで0で埋める(mysqlから読み込んだ値と同じ形式、指数表記はそのまま)
+func padDecimalScale(col *models.Column, n string) string {
+	m := columnTypeDecimalRegexp.FindStringSubmatch(strings.ToLower(strings.TrimSpace(col.Type)))
+	if m == nil || strings.ContainsAny(n, "eE") {
+		return n
+	}
+	scale, _ := strconv.Atoi(m[2])
+	digits := 0
+	if i := strings.Index(n, "."); i < 0 {
+		if scale == 0 {
+			return n
+		}
+		n += "."
+	} else {
+		digits = len(n) - i - 1
+	}
+	if digits < scale {
+		n += strings.Repeat("0", scale-digits)
+	}
+	return n
+}
+
+// mysqlから読み込んだbitの値(ビッグエンディアンのバイト列)を10進数にする
+func fromMysqlBitValue(v string) string {
+	var n uint64
+	for _, b := range []byte(v) {
+		n = n<<8 | uint64(b)
+	}
+	return strconv.FormatUint(n, 10)
+}
+
+func parseBitValue(v string) (uint64, bool) {
+	lower := strings.ToLower(v)
+	var n uint64
+	var err error
+	switch {
+	case lower == "true":
+		return 1, true
+	case lower == "false":
+		return 0, true
+	case strings.HasPrefix(lower, "b'") && strings.HasSuffix(lower, "'"):
+		n, err = strconv.ParseUint(v[2:len(v)-1], 2, 64)
+	case strings.HasPrefix(lower, "0b"):
+		n, err = strconv.ParseUint(v[2:], 2, 64)
+	case strings.HasPrefix(lower, "0x"):
+		n, err = strconv.ParseUint(v[2:], 16, 64)
+	default:
+		n, err = strconv.ParseUint(v, 10, 64)
+	}
+	return n, err == nil
+}
+
+// 0x..., X'...'の16進数
+func parseHexValue(v string) ([]byte, bool) {
+	lower := strings.ToLower(v)
+	var s string
+	switch {
+	case strings.HasPrefix(lower, "0x"):
+		s = v[2:]
+	case strings.HasPrefix(lower, "x'") && strings.HasSuffix(lower, "'") && len(v) >= 3:
+		s = v[2 : len(v)-1]
+	default:
+		return nil, false
+	}
+	if len(s)%2 != 0 {
+		s = "0" + s
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+func parseTimeValue(v string) (time.Time, bool) {
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, true
+		}
+	}
+	// Excelのシリアル値
+	if f, err := strconv.ParseFloat(v, 64); err == nil && 0 <= f && numberValueRegexp.MatchString(v) {
+		return xlsx.TimeFromExcelTime(f, false).Round(time.Second), true
+	}
+	return time.Time{}, false
+}
+
+func formatColumnTime(col *models.Column, t time.Time) string {
+	switch columnValueType(col) {
+	case columnValueDate:
+		return t.Format("2006-01-02")
+	case columnValueTime:
+		return t.Format("15:04:05.999999")
+	}
+	return t.Format("2006-01-02 15:04:05.999999")
+}
+
+/**
+toColumnValueの値のSQLのリテラル
+	数値, bool, bitはクォートしない、binaryはX'...'、式はそのまま
+*/
+func toColumnSQLLiteral(col *models.Column, v DBValue) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case sqlExpression:
+		return string(t)
+	}
+	s := ToString(normalizeDBValue(v))
+	if col == nil {
+		return "'" + escapeValue(s) + "'"
+	}
+	switch columnValueType(col) {
+	case columnValueNumber, columnValueBool, columnValueBit:
+		if numberValueRegexp.MatchString(s) {
+			return s
+		}
+	case columnValueBinary:
+		if s == "" {
+			return "''"
+		}
+		return "X'" + strings.ToUpper(hex.EncodeToString([]byte(s))) + "'"
+	}
+	return "'" + escapeValue(s) + "'"
+}
+
+// toColumnValueの値をプレースホルダの値にする(decimalはmysqlから読み込んだ値と同じ形式)
+func toColumnArg(col *models.Column, v DBValue) interface{} {
+	s, ok := v.(string)
+	if !ok || col == nil {
+		return v
+	}
+	switch columnValueType(col) {
+	case columnValueNumber:
+		if numberValueRegexp.MatchString(s) {
+			return padDecimalScale(col, s)
+		}
+	case columnValueBit:
+		// 文字列はバイト列として扱われるため数値にする
+		if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return n
+		}
+	case columnValueBinary:
+		return []byte(s)
+	}
+	return s
+}
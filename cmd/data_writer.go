@@ -0,0 +1,364 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+/**
+テーブルデータを1行ずつ出力する
+BeginTable, WriteRow..., EndTableをテーブル毎に繰り返し、最後にClose
+*/
+type rowWriter interface {
+	BeginTable(name string, keys []string)
+	WriteRow(row DBRow)
+	EndTable()
+	Close()
+}
+
+func newRowWriter(format string, w io.Writer, arg *DataArg) rowWriter {
+	switch format {
+	case "sql":
+		return newSqlRowWriter(w, arg)
+	case "json":
+		return newJsonRowWriter(w)
+	case "xlsx":
+		return newExcelRowWriter(w)
+	case "yaml", "yml":
+		return newYamlRowWriter(w, arg)
+	}
+	panic(fmt.Sprint("output format invalid:", format))
+}
+
+// 全テーブルを出力する
+func writeData(d *Data, w rowWriter) {
+	for _, t := range d.Tables {
+		w.BeginTable(t.Name, t.Keys)
+		cursor := newTableDataCursor(t)
+		for cursor.Next() {
+			w.WriteRow(cursor.Row())
+		}
+		cursor.Close()
+		w.EndTable()
+	}
+}
+
+//==========================================================================
+/**
+テーブル毎の書き込み方法(--mode, --table-mode)のINSERT文
+	truncate, delete: TRUNCATE, DELETE + INSERT
+	insert, upsert, replace, ignore: INSERT, INSERT ... ON DUPLICATE KEY UPDATE, REPLACE, INSERT IGNORE
+	sync: INSERT ... ON DUPLICATE KEY UPDATE + 出力していない主キーの行をDELETE(主キーは--defines)
+	--rows-per-insert, --max-insert-bytes: INSERT文を分割(指定がなければテーブル毎に1つ)
+	--lock-tables, --disable-keys: テーブル毎にLOCK TABLES, DISABLE KEYSで囲む
+	--batches-per-transaction: INSERT文N個毎にCOMMIT
+*/
+type sqlRowWriter struct {
+	w       *bufio.Writer
+	arg     *DataArg
+	defines *tableMaps
+
+	rowsPerInsert         int
+	maxInsertBytes        int
+	lockTables            bool
+	disableKeys           bool
+	batchesPerTransaction int
+
+	name string
+	keys []string
+	mode string
+	rows int
+	// 出力中のINSERT文
+	header         string
+	footer         string
+	statementRows  int
+	statementBytes int
+	batches        int
+	// syncで出力した主キー
+	pkIndexes []int
+	pkValues  []string
+}
+
+func newSqlRowWriter(w io.Writer, arg *DataArg) *sqlRowWriter {
+	res := &sqlRowWriter{
+		w:                     bufio.NewWriter(w),
+		arg:                   arg,
+		rowsPerInsert:         arg.RowsPerInsert,
+		maxInsertBytes:        arg.MaxInsertBytes,
+		lockTables:            arg.LockTables,
+		disableKeys:           arg.DisableKeys,
+		batchesPerTransaction: arg.BatchesPerTransaction,
+	}
+	if 0 < len(arg.Defines) {
+		res.defines = loadModelToMap(arg)
+	}
+	return res
+}
+
+func (this *sqlRowWriter) BeginTable(name string, keys []string) {
+	this.name = name
+	this.keys = keys
+	this.rows = 0
+	this.statementRows = 0
+	this.batches = 0
+	this.mode = this.arg.TableMode(name)
+	switch this.mode {
+	case dataModeTruncate:
+		this.w.WriteString("TRUNCATE `")
+		this.w.WriteString(name)
+		this.w.WriteString("`;\n")
+	case dataModeDelete:
+		this.w.WriteString("DELETE FROM `")
+		this.w.WriteString(name)
+		this.w.WriteString("`;\n")
+	case dataModeSync:
+		this.pkIndexes = syncPrimaryKeyIndexes(this.defines, name, keys)
+		this.pkValues = make([]string, 0)
+	}
+
+	//keys
+	keys = make([]string, 0)
+	for _, k := range this.keys {
+		keys = append(keys, "`"+k+"`")
+	}
+	this.header = insertStatement(this.mode) + " `" + name + "` (" + strings.Join(keys, ", ") + ") \nVALUES \n"
+	this.footer = ""
+	if this.mode == dataModeUpsert || this.mode == dataModeSync {
+		this.footer = "\n" + onDuplicateKeyUpdate(keys)
+	}
+}
+
+func (this *sqlRowWriter) WriteRow(row DBRow) {
+	if this.rows == 0 {
+		this.beginInserts()
+	}
+	this.rows++
+
+	values := make([]string, 0)
+	for i, rawV := range row {
+		values = append(values, this.toSQLValue(this.keys[i], rawV))
+	}
+	value := "(" + strings.Join(values, ",") + ")"
+	if this.mode == dataModeSync {
+		pk := make([]string, 0, len(this.pkIndexes))
+		for _, i := range this.pkIndexes {
+			pk = append(pk, values[i])
+		}
+		this.pkValues = append(this.pkValues, "("+strings.Join(pk, ",")+")")
+	}
+
+	// 行数, バイト数の上限を超える場合は次のINSERT文
+	if this.statementRows != 0 {
+		if (0 < this.rowsPerInsert && this.rowsPerInsert <= this.statementRows) ||
+			(0 < this.maxInsertBytes && this.maxInsertBytes < this.statementBytes+len(",\n")+len(value)+len(this.footer)+len(";")) {
+			this.endStatement()
+		}
+	}
+
+	if this.statementRows == 0 {
+		this.w.WriteString(this.header)
+		this.statementBytes = len(this.header)
+		if 0 < this.maxInsertBytes && this.maxInsertBytes < this.statementBytes+len(value)+len(this.footer)+len(";") {
+			fmt.Fprintf(os.Stderr, "warning: a row exceeds --max-insert-bytes=%d: %s row %d\n", this.maxInsertBytes, this.name, this.rows)
+		}
+	} else {
+		this.w.WriteString(",\n")
+		this.statementBytes += len(",\n")
+	}
+	this.w.WriteString(value)
+	this.statementRows++
+	this.statementBytes += len(value)
+}
+
+func (this *sqlRowWriter) beginInserts() {
+	if this.batchesPerTransaction != 0 {
+		this.w.WriteString("SET autocommit=0;\n")
+	}
+	if this.lockTables {
+		this.w.WriteString("LOCK TABLES `" + this.name + "` WRITE;\n")
+	}
+	if this.disableKeys {
+		this.w.WriteString("ALTER TABLE `" + this.name + "` DISABLE KEYS;\n")
+	}
+}
+
+func (this *sqlRowWriter) endStatement() {
+	this.w.WriteString(this.footer)
+	this.w.WriteString(";\n")
+	this.statementRows = 0
+	this.batches++
+	if this.batchesPerTransaction != 0 && this.batches%this.batchesPerTransaction == 0 {
+		this.w.WriteString("COMMIT;\n")
+	}
+}
+
+/**
+値のSQLのリテラル
+	--definesにカラムがある場合はカラムの型に合わせる(toColumnValue)
+	"null"はnull、"\null"は文字列"null"
+*/
+func (this *sqlRowWriter) toSQLValue(key string, rawV DBValue) string {
+	if rawV == nil {
+		return "null"
+	}
+	if this.defines != nil {
+		if col := this.defines.GetColumn(this.name, key); col != nil {
+			return toColumnSQLLiteral(col, toColumnValue(col, rawV))
+		}
+	}
+	v := ToString(rawV)
+	if strings.ToLower(v) == "null" {
+		return "null"
+	}
+	if u := unescapeValue(v); escapedNullRegexp.MatchString(u) {
+		return "'" + escapeValue(u[1:]) + "'"
+	}
+	return "'" + v + "'"
+}
+
+func (this *sqlRowWriter) EndTable() {
+	if this.rows == 0 {
+		// 空のテーブルのsyncは全行を削除
+		if this.mode == dataModeSync {
+			this.w.WriteString("DELETE FROM `" + this.name + "`;\n\n")
+		}
+		return
+	}
+	this.endStatement()
+	if this.mode == dataModeSync {
+		this.writeSyncDelete()
+		this.pkValues = nil
+		if this.batchesPerTransaction != 0 {
+			this.w.WriteString("COMMIT;\n")
+		}
+	} else if this.batchesPerTransaction != 0 && this.batches%this.batchesPerTransaction != 0 {
+		this.w.WriteString("COMMIT;\n")
+	}
+	if this.disableKeys {
+		this.w.WriteString("ALTER TABLE `" + this.name + "` ENABLE KEYS;\n")
+	}
+	if this.lockTables {
+		this.w.WriteString("UNLOCK TABLES;\n")
+	}
+	if this.batchesPerTransaction != 0 {
+		this.w.WriteString("SET autocommit=1;\n")
+	}
+	this.w.WriteString("\n")
+}
+
+/**
+出力していない主キーの行を削除
+	主キーを一時テーブルに--rows-per-insert, --max-insert-bytesで分割してINSERTし、一致しない行を削除
+*/
+func (this *sqlRowWriter) writeSyncDelete() {
+	pk := make([]string, 0)
+	for _, i := range this.pkIndexes {
+		pk = append(pk, "`"+this.keys[i]+"`")
+	}
+	keys := strings.Join(pk, ", ")
+	tmp := "`_sync_" + this.name + "`"
+	this.w.WriteString("CREATE TEMPORARY TABLE " + tmp + " (PRIMARY KEY (" + keys + ")) SELECT " + keys + " FROM `" + this.name + "` LIMIT 0;\n")
+	this.writeValues("INSERT INTO "+tmp+" ("+keys+") \nVALUES \n", this.pkValues)
+	this.w.WriteString("DELETE `" + this.name + "` FROM `" + this.name + "` LEFT JOIN " + tmp + " USING (" + keys + ") WHERE " + tmp + "." + pk[0] + " IS NULL;\n")
+	this.w.WriteString("DROP TEMPORARY TABLE " + tmp + ";\n")
+}
+
+// valuesを--rows-per-insert, --max-insert-bytesで分割したINSERT文
+func (this *sqlRowWriter) writeValues(header string, values []string) {
+	rows := 0
+	size := 0
+	for _, value := range values {
+		if rows != 0 && ((0 < this.rowsPerInsert && this.rowsPerInsert <= rows) ||
+			(0 < this.maxInsertBytes && this.maxInsertBytes < size+len(",\n")+len(value)+len(";"))) {
+			this.w.WriteString(";\n")
+			rows = 0
+		}
+		if rows == 0 {
+			this.w.WriteString(header)
+			size = len(header)
+		} else {
+			this.w.WriteString(",\n")
+			size += len(",\n")
+		}
+		this.w.WriteString(value)
+		rows++
+		size += len(value)
+	}
+	if rows != 0 {
+		this.w.WriteString(";\n")
+	}
+}
+
+func (this *sqlRowWriter) Close() {
+	checkError(this.w.Flush())
+}
+
+//==========================================================================
+// jsonutil.ToJson(Data)と同じ形式
+type jsonRowWriter struct {
+	w      *bufio.Writer
+	tables int
+	rows   int
+}
+
+func newJsonRowWriter(w io.Writer) *jsonRowWriter {
+	return &jsonRowWriter{
+		w: bufio.NewWriter(w),
+	}
+}
+
+func (this *jsonRowWriter) BeginTable(name string, keys []string) {
+	if this.tables == 0 {
+		this.w.WriteString("{\n  \"Tables\": [\n")
+	} else {
+		this.w.WriteString(",\n")
+	}
+	this.tables++
+	this.rows = 0
+
+	this.w.WriteString("    {\n      \"Name\": ")
+	this.writeIndented(name, "      ")
+	this.w.WriteString(",\n      \"Keys\": ")
+	this.writeIndented(keys, "      ")
+	this.w.WriteString(",\n      \"Values\": [")
+}
+
+func (this *jsonRowWriter) WriteRow(row DBRow) {
+	if this.rows == 0 {
+		this.w.WriteString("\n        ")
+	} else {
+		this.w.WriteString(",\n        ")
+	}
+	this.rows++
+	this.writeIndented(row, "        ")
+}
+
+func (this *jsonRowWriter) EndTable() {
+	if this.rows != 0 {
+		this.w.WriteString("\n      ")
+	}
+	this.w.WriteString("]\n    }")
+}
+
+func (this *jsonRowWriter) Close() {
+	if this.tables == 0 {
+		this.w.WriteString("{\n  \"Tables\": []\n}")
+	} else {
+		this.w.WriteString("\n  ]\n}")
+	}
+	this.w.WriteString("\n")
+	checkError(this.w.Flush())
+}
+
+func (this *jsonRowWriter) writeIndented(v interface{}, prefix string) {
+	b, err := json.Marshal(v)
+	checkError(err)
+	buf := bytes.NewBuffer(nil)
+	checkError(json.Indent(buf, b, prefix, "  "))
+	this.w.Write(buf.Bytes())
+}
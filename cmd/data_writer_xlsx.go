@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alfalfalfa/xlsx"
+)
+
+// Excelのシート名の最大長
+const excelSheetNameMaxLength = 31
+
+/**
+Excel出力
+xlsx.Fileは全セルをメモリに保持するため、シートを1行ずつzipに書き込む
+	文字列はインライン文字列(sharedStringsを使わない)
+	NULLは"null"(読み込み時にnullとして扱われる)
+	文字列はエスケープを解除(文字列"null"は"\null")
+*/
+type excelRowWriter struct {
+	zip    *zip.Writer
+	sheets []string
+
+	sheet *bufio.Writer
+	rows  int
+}
+
+func newExcelRowWriter(w io.Writer) *excelRowWriter {
+	return &excelRowWriter{
+		zip:    zip.NewWriter(w),
+		sheets: make([]string, 0),
+	}
+}
+
+func (this *excelRowWriter) BeginTable(name string, keys []string) {
+	if excelSheetNameMaxLength < len([]rune(name)) {
+		panic(fmt.Sprintf("sheet name must be %d characters or less: %s", excelSheetNameMaxLength, name))
+	}
+	this.sheets = append(this.sheets, name)
+	f, err := this.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(this.sheets)))
+	checkError(err)
+	this.sheet = bufio.NewWriter(f)
+	this.rows = 0
+
+	this.sheet.WriteString(xml.Header)
+	this.sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheetData>`)
+
+	//カラムヘッダー行
+	header := make(DBRow, 0, len(keys))
+	for _, k := range keys {
+		header = append(header, escapeValue(k))
+	}
+	this.writeRow(header, excelHeaderStyleIndex)
+}
+
+func (this *excelRowWriter) WriteRow(row DBRow) {
+	this.writeRow(row, 0)
+}
+
+func (this *excelRowWriter) writeRow(row DBRow, style int) {
+	y := this.rows
+	this.rows++
+	this.sheet.WriteString(`<row r="` + strconv.Itoa(y+1) + `">`)
+	for x, v := range row {
+		this.writeCell(xlsx.GetCellIDStringFromCoords(x, y), v, style)
+	}
+	this.sheet.WriteString(`</row>`)
+}
+
+func (this *excelRowWriter) writeCell(ref string, v DBValue, style int) {
+	this.sheet.WriteString(`<c r="` + ref + `"`)
+	if style != 0 {
+		this.sheet.WriteString(` s="` + strconv.Itoa(style) + `"`)
+	}
+	switch t := v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		this.sheet.WriteString(`><v>` + ToString(t) + `</v></c>`)
+		return
+	}
+
+	var s string
+	switch t := v.(type) {
+	case nil:
+		s = "null"
+	case string:
+		s = unescapeValue(t)
+	case []byte:
+		s = unescapeValue(string(t))
+	case time.Time:
+		s = t.Format("2006-01-02 15:04:05")
+	default:
+		s = ToString(t)
+	}
+	this.sheet.WriteString(` t="inlineStr"><is><t xml:space="preserve">`)
+	checkError(xml.EscapeText(this.sheet, []byte(s)))
+	this.sheet.WriteString(`</t></is></c>`)
+}
+
+func (this *excelRowWriter) EndTable() {
+	this.sheet.WriteString(`</sheetData></worksheet>`)
+	checkError(this.sheet.Flush())
+	this.sheet = nil
+}
+
+func (this *excelRowWriter) Close() {
+	if len(this.sheets) == 0 {
+		panic("no table to output xlsx")
+	}
+	this.writeFile("[Content_Types].xml", this.contentTypes())
+	this.writeFile("_rels/.rels", excelRootRels)
+	this.writeFile("xl/workbook.xml", this.workbook())
+	this.writeFile("xl/_rels/workbook.xml.rels", this.workbookRels())
+	this.writeFile("xl/styles.xml", excelStyles)
+	checkError(this.zip.Close())
+}
+
+func (this *excelRowWriter) writeFile(name, content string) {
+	f, err := this.zip.Create(name)
+	checkError(err)
+	_, err = io.WriteString(f, content)
+	checkError(err)
+}
+
+func (this *excelRowWriter) contentTypes() string {
+	s := xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`
+	for i := range this.sheets {
+		s += fmt.Sprintf(`<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	return s + `</Types>`
+}
+
+func (this *excelRowWriter) workbook() string {
+	s := xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`
+	for i, name := range this.sheets {
+		s += fmt.Sprintf(`<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escapeXMLAttr(name), i+1, i+1)
+	}
+	return s + `</sheets></workbook>`
+}
+
+func (this *excelRowWriter) workbookRels() string {
+	s := xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`
+	for i := range this.sheets {
+		s += fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	s += fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(this.sheets)+1)
+	return s + `</Relationships>`
+}
+
+func escapeXMLAttr(s string) string {
+	b := &strings.Builder{}
+	checkError(xml.EscapeText(b, []byte(s)))
+	return b.String()
+}
+
+const excelRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// ヘッダー行のスタイル(models.SetHeaderStyleと同じ)
+const excelHeaderStyleIndex = 1
+
+const excelStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><sz val="11"/><color rgb="00FFFFFF"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill>` +
+	`<fill><patternFill patternType="solid"><fgColor rgb="00606060"/><bgColor rgb="00FFFFFF"/></patternFill></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/></cellXfs>` +
+	`</styleSheet>`
@@ -0,0 +1,335 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+	"gopkg.in/yaml.v2"
+)
+
+// yaml出力の形式
+const (
+	// テーブル名: [{カラム名: 値}]
+	yamlLayoutKeyed = "keyed"
+	// Tables: [{Name, Keys, Values}](jsonと同じ)
+	yamlLayoutPositional = "positional"
+)
+
+/**
+yaml(形式は内容から判別)
+	Tables: [{Name, Keys, Values}]
+	テーブル名: [{カラム名: 値}]
+	[{カラム名: 値}](testfixtures、ファイル名がテーブル名)
+ディレクトリの場合は含まれる.yaml, .ymlファイル
+*/
+func NewDataFromYaml(arg *DataArg) *Data {
+	res := &Data{
+		Tables: make([]*TableData, 0),
+	}
+	for _, path := range models.ResolvFilePathes(arg.Inputs...) {
+		if models.DetectInputFormat(path) != "yaml" {
+			continue
+		}
+		for _, t := range loadTableDataFromYaml(path) {
+			t.Sources = newDataSources(path, t)
+			if !containsOrEmpty(arg.Tables, t.Name) {
+				continue
+			}
+			if contains(arg.IgnoreTables, t.Name) {
+				continue
+			}
+			if len(t.Values) == 0 && !arg.WritesEmptyTable(t.Name) {
+				continue
+			}
+			// 同名テーブルはマージ(重複チェックはしない)
+			if exist := findTableData(res.Tables, t.Name); exist != nil {
+				for _, row := range t.Values {
+					exist.Values = append(exist.Values, projectRow(row, t.Keys, exist.Keys))
+				}
+				exist.Sources = append(exist.Sources, t.Sources...)
+			} else {
+				res.Tables = append(res.Tables, t)
+			}
+		}
+	}
+	return res
+}
+
+func loadTableDataFromYaml(path string) []*TableData {
+	b, err := ioutil.ReadFile(path)
+	checkError(err)
+
+	// testfixtures
+	var rows []yaml.MapSlice
+	if err := yaml.Unmarshal(b, &rows); err == nil {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		return []*TableData{newTableDataFromYamlRows(name, rows)}
+	}
+
+	var m yaml.MapSlice
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		panic(fmt.Sprintf("%s: %v", path, err))
+	}
+	res := make([]*TableData, 0)
+	if len(m) == 1 && m[0].Key == "Tables" {
+		for _, item := range toYamlList(path, m[0].Value) {
+			res = append(res, newTableDataFromYamlPositional(path, toYamlMap(path, item)))
+		}
+		return res
+	}
+	for _, item := range m {
+		rows := make([]yaml.MapSlice, 0)
+		for _, row := range toYamlList(path, item.Value) {
+			rows = append(rows, toYamlMap(path, row))
+		}
+		res = append(res, newTableDataFromYamlRows(ToString(item.Key), rows))
+	}
+	return res
+}
+
+// カラムは全行のキーの出現順、キーのない値は空
+func newTableDataFromYamlRows(name string, rows []yaml.MapSlice) *TableData {
+	res := &TableData{
+		Name:   name,
+		Keys:   make([]string, 0),
+		Values: make([]DBRow, 0),
+	}
+	for _, row := range rows {
+		for _, item := range row {
+			if indexOfKey(res.Keys, ToString(item.Key)) < 0 {
+				res.Keys = append(res.Keys, ToString(item.Key))
+			}
+		}
+	}
+	for _, row := range rows {
+		values := make(DBRow, len(res.Keys))
+		for i := range values {
+			values[i] = ""
+		}
+		for _, item := range row {
+			values[indexOfKey(res.Keys, ToString(item.Key))] = fromYamlValue(item.Value)
+		}
+		res.Values = append(res.Values, values)
+	}
+	return res
+}
+
+func newTableDataFromYamlPositional(path string, m yaml.MapSlice) *TableData {
+	res := &TableData{
+		Keys:   make([]string, 0),
+		Values: make([]DBRow, 0),
+	}
+	for _, item := range m {
+		switch item.Key {
+		case "Name":
+			res.Name = ToString(item.Value)
+		case "Keys":
+			for _, k := range toYamlList(path, item.Value) {
+				res.Keys = append(res.Keys, ToString(k))
+			}
+		case "Values":
+			for _, row := range toYamlList(path, item.Value) {
+				values := make(DBRow, 0)
+				for _, v := range toYamlList(path, row) {
+					values = append(values, fromYamlValue(v))
+				}
+				res.Values = append(res.Values, values)
+			}
+		}
+	}
+	return res
+}
+
+func toYamlList(path string, v interface{}) []interface{} {
+	if v == nil {
+		return []interface{}{}
+	}
+	res, ok := v.([]interface{})
+	if !ok {
+		panic(fmt.Sprintf("%s: list required: %v", path, v))
+	}
+	return res
+}
+
+func toYamlMap(path string, v interface{}) yaml.MapSlice {
+	res, ok := v.(yaml.MapSlice)
+	if !ok {
+		panic(fmt.Sprintf("%s: map required: %v", path, v))
+	}
+	return res
+}
+
+// Excelの値と同じ(文字列はエスケープ、nullは"null"、文字列"null"は"\\null")
+func fromYamlValue(v interface{}) DBValue {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		if t {
+			return "1"
+		}
+		return "0"
+	case string:
+		return toDataString(t)
+	case time.Time:
+		return t.Format("2006-01-02 15:04:05")
+	}
+	return ToString(v)
+}
+
+// 値は "data -f sql | exec" で書き込まれる値(エスケープを解除、文字列"null"は"null")
+func toYamlValue(v DBValue) interface{} {
+	s, ok := fromDataString(v)
+	if !ok {
+		return nil
+	}
+	return s
+}
+
+//==========================================================================
+// yaml出力
+type yamlRowWriter struct {
+	w      *bufio.Writer
+	layout string
+	tables int
+
+	keys []string
+	rows int
+}
+
+func newYamlRowWriter(w io.Writer, arg *DataArg) *yamlRowWriter {
+	if arg.YamlLayout != yamlLayoutKeyed && arg.YamlLayout != yamlLayoutPositional {
+		panic(fmt.Sprintf("yaml layout invalid: %s (%s, %s)", arg.YamlLayout, yamlLayoutKeyed, yamlLayoutPositional))
+	}
+	return &yamlRowWriter{
+		w:      bufio.NewWriter(w),
+		layout: arg.YamlLayout,
+	}
+}
+
+func (this *yamlRowWriter) BeginTable(name string, keys []string) {
+	this.keys = keys
+	this.rows = 0
+	if this.layout == yamlLayoutKeyed {
+		this.w.WriteString(strings.TrimSuffix(marshalYaml(name), "\n") + ":")
+		return
+	}
+
+	if this.tables == 0 {
+		this.w.WriteString("Tables:\n")
+	}
+	this.w.WriteString("- Name: " + marshalYaml(name))
+	if len(keys) == 0 {
+		this.w.WriteString("  Keys: []\n")
+	} else {
+		this.w.WriteString("  Keys:\n")
+		writeYamlItem(this.w, "  ", keys)
+	}
+	this.w.WriteString("  Values:")
+	this.tables++
+}
+
+func (this *yamlRowWriter) WriteRow(row DBRow) {
+	if this.rows == 0 {
+		this.w.WriteString("\n")
+	}
+	this.rows++
+	if this.layout == yamlLayoutKeyed {
+		writeYamlItem(this.w, "", []interface{}{toYamlRow(this.keys, row)})
+		return
+	}
+	values := make([]interface{}, 0, len(row))
+	for _, v := range row {
+		values = append(values, toYamlValue(v))
+	}
+	writeYamlItem(this.w, "  ", []interface{}{values})
+}
+
+func (this *yamlRowWriter) EndTable() {
+	if this.rows == 0 {
+		this.w.WriteString(" []\n")
+	}
+}
+
+func (this *yamlRowWriter) Close() {
+	if this.layout == yamlLayoutPositional && this.tables == 0 {
+		this.w.WriteString("Tables: []\n")
+	}
+	checkError(this.w.Flush())
+}
+
+//==========================================================================
+// testfixtures出力(OUTPUTのディレクトリに<テーブル名>.yml)
+type fixtureRowWriter struct {
+	dir string
+
+	file *os.File
+	w    *bufio.Writer
+	keys []string
+	rows int
+}
+
+func newFixtureRowWriter(dir string) *fixtureRowWriter {
+	if dir == "" {
+		panic("testfixtures requires output directory")
+	}
+	checkError(os.MkdirAll(dir, os.ModePerm))
+	return &fixtureRowWriter{
+		dir: dir,
+	}
+}
+
+func (this *fixtureRowWriter) BeginTable(name string, keys []string) {
+	f, err := os.Create(filepath.Join(this.dir, name+".yml"))
+	checkError(err)
+	this.file = f
+	this.w = bufio.NewWriter(f)
+	this.keys = keys
+	this.rows = 0
+}
+
+func (this *fixtureRowWriter) WriteRow(row DBRow) {
+	this.rows++
+	writeYamlItem(this.w, "", []interface{}{toYamlRow(this.keys, row)})
+}
+
+func (this *fixtureRowWriter) EndTable() {
+	if this.rows == 0 {
+		this.w.WriteString("[]\n")
+	}
+	checkError(this.w.Flush())
+	checkError(this.file.Close())
+	fmt.Println(this.file.Name())
+}
+
+func (this *fixtureRowWriter) Close() {
+}
+
+func toYamlRow(keys []string, row DBRow) yaml.MapSlice {
+	res := make(yaml.MapSlice, 0, len(row))
+	for i, v := range row {
+		res = append(res, yaml.MapItem{Key: keys[i], Value: toYamlValue(v)})
+	}
+	return res
+}
+
+// リストの要素をindentの位置に出力
+func writeYamlItem(w *bufio.Writer, indent string, list interface{}) {
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(marshalYaml(list), "\n"), "\n") {
+		w.WriteString(indent + line)
+	}
+	w.WriteString("\n")
+}
+
+func marshalYaml(v interface{}) string {
+	b, err := yaml.Marshal(v)
+	checkError(err)
+	return string(b)
+}
@@ -13,6 +13,8 @@ import (
 
 	"path/filepath"
 
+	"strings"
+
 	"github.com/alfalfalfa/mysql_tool/models"
 	"github.com/alfalfalfa/mysql_tool/util/copy"
 	"github.com/docopt/docopt-go"
@@ -24,7 +26,7 @@ const usageDiff = `mysql_tool diff
 
 Usage:
     mysql_tool diff -h | --help
-    mysql_tool diff [--old OLD] [-f FORMAT] [-o OUTPUT] [--foreign-key] [--ignore-tables IGNORE_TABLES...] [--json-comment] INPUTS...
+    mysql_tool diff [--old OLD] [-f FORMAT] [-o OUTPUT] [--foreign-key] [--ignore-tables IGNORE_TABLES...] [--json-comment] [--mysql-version VERSION] [--explain-algorithm] [--algorithm-clause] [--osc-threshold SIZE] [--ignore-column-order] [--auto-increment] [--rules RULES] [--phased] [--split] [--overwrite] INPUTS...
 
 Arg:
     入力ファイルパス（json, yaml, xlsx, dir） | mysql dsn(https://github.com/go-sql-driver/mysql#dsn-data-source-name)
@@ -43,6 +45,10 @@ Options:
             goose-up, goose-downを出力
         "diff"
             create table文のdiffを出力
+        "markdown"
+            テーブル毎の変更レポート(Markdown)を出力
+        "html"
+            テーブル毎の変更レポート(HTML)を出力
     -o OUTPUT, --output=OUTPUT    出力先
         ディレクトリ
             日付からファイル名生成
@@ -51,13 +57,68 @@ Options:
         none
             標準出力
     --foreign-key                 外部キーの出力
+        テーブルは外部キーの依存順に作成(削除は逆順)
+        循環参照/自己参照の外部キーは末尾のALTERで追加
     --ignore-tables=IGNORE_TABLES...      無視テーブル
     --json-comment                メタデータjsonのコメント埋め込み
+    --ignore-column-order         カラム並び順の変更を出力しない(--rulesのattributes: column_orderと同じ)
+    --auto-increment              テーブルのAUTO_INCREMENT値(mysql dsnのみ)の変更を出力する
+    --rules=RULES                 差分の無視ルール(yaml)
+        attributes
+            差分を無視する属性(comment, default, column_order, auto_increment, collation)
+            既存テーブル/カラムはOLDの値を維持する
+            auto_increment はテーブルのAUTO_INCREMENT値(--auto-increment指定時のみ比較、カラムのAUTO_INCREMENT指定は常に比較する)
+        tables, columns, indexes
+            無視するテーブル, カラム(table.column), インデックス(table.index)のglob
+            例: tables: ["_*_gho", "_*_ghc", "_*_del"]
+    --phased                      expand/contractの2段階に分けて出力(sql, gooseのみ)
+        expand
+            テーブル/カラム/インデックスの追加、変更
+            リネームは新カラムを追加して値をコピー、型変更は一時カラム(xxx_new)を追加して値をコピー
+            追加するカラムはNULL可(デフォルト値のないNOT NULLの場合)
+        contract
+            値の再コピー、テーブル/カラムの削除、リネーム前のカラムの削除、一時カラムとの入れ替え
+            expandでNULL可としたカラムをNOT NULLに変更
+            Deprecatedのカラム(メタデータjsonの{"deprecated": true})はcontractで削除
+        出力先がディレクトリの場合、expand, contractの順に連番のファイルを出力
+    --split                       テーブル毎にマイグレーションを分割して出力(sql, gooseのみ)
+        循環参照の外部キーで結ばれたテーブルは1つにまとめる
+        外部キーの依存順(作成/変更は参照先が先、削除は参照元が先)に連番のファイルを出力
+        --phasedと同時に指定した場合、expand, contractそれぞれを分割
+    --overwrite                   差分出力後、OLDを新しい定義で上書き
+        json, yaml
+            OLDと同じフォーマットで上書き
+        ディレクトリ
+            1テーブル1ファイルで上書き(削除されたテーブルのファイルは削除)
+    --mysql-version=VERSION       出力対象のMySQLバージョン(例: 5.7, 8.0.32)
+        none
+            OLDがmysql dsnであれば接続先から検出、それ以外は5.7
+        8.0.19以降
+            整数型の表示幅を比較/出力しない
+        8.0以降
+            RENAME COLUMN, ALTER INDEX ... [IN]VISIBLE を使用
+        8.0.12以降
+            末尾へのカラム追加にALGORITHM=INSTANTを付与(8.0.29以降は任意位置)
+        5.7
+            5.7互換の出力(INVISIBLEは出力しない)
+        5.7以降
+            名前のみ異なるインデックスはRENAME INDEXを使用
+    --explain-algorithm           alter文毎にMySQLが選択するALGORITHM(INSTANT, INPLACE, COPY)とLOCKの予測をコメント出力
+        --mysql-versionと変更内容(末尾へのカラム追加, varcharの拡張, インデックス追加, 外部キー変更等)から判定
+    --algorithm-clause            alter文に予測したALGORITHM, LOCK句を付与
+        予測と異なるテーブルコピー等が必要な場合、MySQLがエラーで中断する
+    --osc-threshold=SIZE          オンラインスキーマ変更ツールの使用を推奨するテーブルサイズ(例: 512M, 1G) [default: 1G]
+        OLDがmysql dsnの場合、レポート(markdown, html)にテーブル再構築の所要時間と必要ディスク容量の見積もりを出力
+        データ+インデックスサイズがSIZE以上のテーブルを警告
+
+Data migration:
+    テーブル/カラムのメタデータjsonにデータ移行SQLを記述すると、その変更が適用される場合のみ前後に出力
+        {"migration": {"pre": "...", "post": "UPDATE ...", "revert_pre": "...", "revert_post": "..."}}
+    pre, post               alterの変更前後
+    revert_pre, revert_post revertの変更前後
+    カラムは追加/変更/リネーム時、テーブルは作成/変更時に出力(jsonでないメタデータは無視)
 `
 
-//[--overwrite]
-//    --overwrite                   oldファイル上書き
-
 type DiffArg struct {
 	Format       string   `arg:"--format"`
 	Output       string   `arg:"--output"`
@@ -67,6 +128,17 @@ type DiffArg struct {
 	Old          string   `arg:"--old"`
 	Overwrite    bool     `arg:"--overwrite"`
 	IgnoreTables []string `arg:"--ignore-tables"`
+	MysqlVersion string   `arg:"--mysql-version"`
+
+	ExplainAlgorithm bool `arg:"--explain-algorithm"`
+	AlgorithmClause  bool `arg:"--algorithm-clause"`
+
+	OscThreshold      string `arg:"--osc-threshold"`
+	IgnoreColumnOrder bool   `arg:"--ignore-column-order"`
+	AutoIncrement     bool   `arg:"--auto-increment"`
+	Rules             string `arg:"--rules"`
+	Phased            bool   `arg:"--phased"`
+	Split             bool   `arg:"--split"`
 }
 
 func RunDiff() {
@@ -76,6 +148,9 @@ func RunDiff() {
 	}
 	arg := &DiffArg{}
 	copy.MapToStructWithTag(arguments, arg, "arg")
+	if arg.Overwrite {
+		checkOverwriteOld(arg)
+	}
 
 	newModel := models.LoadModel(arg.IgnoreTables, arg.Inputs...)
 	var output string
@@ -86,72 +161,246 @@ func RunDiff() {
 	} else {
 		oldModel = models.LoadModel(arg.IgnoreTables, arg.Old)
 	}
+	setTargetVersion(arg.MysqlVersion, oldModel)
+
+	rule := loadDiffRule(arg.Rules)
+	if arg.IgnoreColumnOrder {
+		rule.AddAttribute(ignoreAttributeColumnOrder)
+	}
+	arg.IgnoreColumnOrder = rule.IgnoresAttribute(ignoreAttributeColumnOrder)
+	if !arg.AutoIncrement {
+		rule.AddAttribute(ignoreAttributeAutoIncrement)
+	}
+	rule.Apply(newModel, oldModel)
+
+	if arg.Phased || arg.Split {
+		if writeMigrationFiles(arg, diffMigrationFiles(arg, newModel, oldModel)) {
+			overwriteDiff(arg, newModel, oldModel)
+		}
+		return
+	}
 
 	switch arg.Format {
 	case "diff":
 		n := newModel.ToCreateSQL(arg.ForeignKey, arg.JsonComment)
 		o := oldModel.ToCreateSQL(arg.ForeignKey, arg.JsonComment)
 		output = diff(o, n)
-	case "sql":
-		alter, _ := diffDefines(arg, newModel, oldModel)
-
-		if alter != "" {
-			output += models.SQL_PREFIX
-			output += alter
-			output += models.SQL_SUFFIX
+	case "sql", "goose":
+		alter, revert := diffDefines(arg, newModel, oldModel)
+		output = formatMigration(arg.Format, alter, revert)
+
+	case "markdown", "html":
+		alter, revert := diffMigrations(arg, newModel, oldModel)
+		changes := collectSchemaChanges(newModel, oldModel, arg.ForeignKey, arg.IgnoreColumnOrder)
+		if len(changes) != 0 {
+			r := newReport(changes, newModel, oldModel, alter, revert)
+			r.EstimateImpact(oldModel, alter, parseSize(arg.OscThreshold))
+			if arg.Format == "html" {
+				output = r.ToHtml()
+			} else {
+				output = r.ToMarkdown()
+			}
 		}
 
+	}
+
+	if output == "" {
+		//fmt.Println("no diff")
+		return
+	}
+	writeDiffOutput(output, arg.Output, arg.Format+diffOutputExt(arg.Format))
+
+	overwriteDiff(arg, newModel, oldModel)
+}
+
+/**
+差分を出力する
+	ディレクトリ: 日付 + "_" + nameのファイル
+	ファイルパス: 上書き
+	none: 標準出力
+*/
+func writeDiffOutput(output string, outputPath string, name string) {
+	if outputPath == "" {
+		fmt.Println(output)
+		return
+	}
+	info, err := os.Stat(outputPath)
+
+	if err != nil || !info.IsDir() {
+		//ファイルパス
+		//上書き
+		os.MkdirAll(filepath.Dir(outputPath), os.ModePerm)
+		fmt.Println(outputPath)
+		checkError(ioutil.WriteFile(outputPath, []byte(output), os.ModePerm))
+	} else {
+		//ディレクトリ
+		//日付からファイル名生成
+		os.MkdirAll(outputPath, os.ModePerm)
+		out := filepath.Join(outputPath, time.Now().Format("20060102150405")+"_"+name)
+		fmt.Println(out)
+		checkError(ioutil.WriteFile(out, []byte(output), os.ModePerm))
+	}
+}
+
+// sql, gooseフォーマットの差分(alterが空の場合は空)
+func formatMigration(format string, alter, revert string) string {
+	output := ""
+	if alter == "" {
+		return output
+	}
+	switch format {
+	case "sql":
+		output += models.SQL_PREFIX
+		output += alter
+		output += models.SQL_SUFFIX
+
 	case "goose":
-		alter, revert := diffDefines(arg, newModel, oldModel)
-		if alter != "" {
-			output += `
+		output += `
 -- +goose Up
 -- SQL in section 'Up' is executed when this migration is applied
 `
-			//XXX goose は文中のトランザクション無視する
-			output += models.SQL_PREFIX
-			output += alter
-			output += models.SQL_SUFFIX
+		//XXX goose は文中のトランザクション無視する
+		output += models.SQL_PREFIX
+		output += alter
+		output += models.SQL_SUFFIX
 
-			output += `
+		output += `
 -- +goose Down
 -- SQL section 'Down' is executed when this migration is rolled back
 `
 
-			output += models.SQL_PREFIX
-			output += revert
-			output += models.SQL_SUFFIX
+		output += models.SQL_PREFIX
+		output += revert
+		output += models.SQL_SUFFIX
+	}
+	return output
+}
 
+// --overwrite指定時、OLDを新しい定義で上書き
+func overwriteDiff(arg *DiffArg, newModel, oldModel *models.Models) {
+	if arg.Overwrite {
+		// 無視ルールを適用した定義ではなく、入力の定義で上書きする
+		if arg.Rules != "" {
+			newModel = models.LoadModel(arg.IgnoreTables, arg.Inputs...)
 		}
+		overwriteOld(arg, newModel, oldModel)
 	}
+}
 
-	if output == "" {
-		//fmt.Println("no diff")
+func diffOutputExt(format string) string {
+	switch format {
+	case "markdown":
+		return ".md"
+	case "html":
+		return ".html"
+	}
+	return ".sql"
+}
+
+// --overwriteのOLDを検査する(差分の出力前)
+func checkOverwriteOld(arg *DiffArg) {
+	if arg.Old == "" {
+		panic("--overwrite requires --old")
+	}
+	info, err := os.Stat(arg.Old)
+	if err != nil {
+		panic(fmt.Sprint("--overwrite: old must be a file or directory:", arg.Old))
+	}
+	pathes := []string{arg.Old}
+	if info.IsDir() {
+		pathes = models.ResolvFilePathes(arg.Old)
+	}
+	for _, path := range pathes {
+		format := models.DetectInputFormat(path)
+		if format != "json" && format != "yaml" {
+			panic(fmt.Sprint("--overwrite: old must be json or yaml:", path))
+		}
+	}
+}
+
+/**
+OLDを新しい定義で上書きする
+無視テーブルはOLDの定義を残す
+*/
+func overwriteOld(arg *DiffArg, newModel, oldModel *models.Models) {
+	info, err := os.Stat(arg.Old)
+	checkError(err)
+
+	tables := make([]*models.Table, 0)
+	tables = append(tables, newModel.Tables...)
+	if 0 < len(arg.IgnoreTables) {
+		for _, t := range models.LoadModel(nil, arg.Old).Tables {
+			if contains(arg.IgnoreTables, t.Name.LowerSnake()) {
+				tables = append(tables, t)
+			}
+		}
+	}
+	m := &models.Models{Tables: tables}
+
+	if info.IsDir() {
+		overwriteOldDir(arg, m)
 		return
 	}
-	if arg.Output == "" {
-		fmt.Println(output)
-	} else {
-		info, err := os.Stat(arg.Output)
-
-		if err != nil || !info.IsDir() {
-			//ファイルパス
-			//上書き
-			os.MkdirAll(filepath.Dir(arg.Output), os.ModePerm)
-			fmt.Println(arg.Output)
-			checkError(ioutil.WriteFile(arg.Output, []byte(output), os.ModePerm))
-		} else {
-			//ディレクトリ
-			//日付からファイル名生成
-			os.MkdirAll(arg.Output, os.ModePerm)
-			name := time.Now().Format("20060102150405") + "_" + arg.Format + ".sql"
-			out := filepath.Join(arg.Output, name)
-			fmt.Println(out)
-			checkError(ioutil.WriteFile(out, []byte(output), os.ModePerm))
+
+	format := models.DetectInputFormat(arg.Old)
+	fmt.Fprintln(os.Stderr, "overwrite:", arg.Old)
+	checkError(ioutil.WriteFile(arg.Old, m.MarshalModel(format, arg.ForeignKey, arg.JsonComment), os.ModePerm))
+}
+
+/**
+ディレクトリの定義ファイルを上書きする
+	既存のテーブル: 定義されていたファイル
+	追加されたテーブル: 複数テーブルのファイルがあれば最初のファイル、なければテーブル名のファイル(拡張子は既存ファイルに合わせる)
+	テーブルがなくなったファイルは削除する
+*/
+func overwriteOldDir(arg *DiffArg, m *models.Models) {
+	files := models.ResolvFilePathes(arg.Old)
+	tableFiles := map[string]string{}
+	combined := ""
+	ext := ".json"
+	for i, path := range files {
+		if i == 0 {
+			ext = filepath.Ext(path)
+		}
+		tables := models.LoadTablesFromFile(path)
+		if 1 < len(tables) && combined == "" {
+			combined = path
 		}
+		for _, t := range tables {
+			tableFiles[t.Name.LowerSnake()] = path
+		}
+	}
+
+	order := make([]string, 0)
+	fileTables := map[string][]*models.Table{}
+	for _, t := range m.Tables {
+		path, ok := tableFiles[t.Name.LowerSnake()]
+		if !ok {
+			path = combined
+		}
+		if path == "" {
+			path = filepath.Join(arg.Old, t.Name.LowerSnake()+ext)
+		}
+		if _, ok := fileTables[path]; !ok {
+			order = append(order, path)
+		}
+		fileTables[path] = append(fileTables[path], t)
 	}
 
-	//Overwrite
+	for _, path := range order {
+		fmt.Fprintln(os.Stderr, "overwrite:", path)
+		fm := &models.Models{Tables: fileTables[path]}
+		checkError(ioutil.WriteFile(path, fm.MarshalModel(models.DetectInputFormat(path), arg.ForeignKey, arg.JsonComment), os.ModePerm))
+	}
+
+	// 削除されたテーブルだけのファイル
+	for _, path := range files {
+		if _, ok := fileTables[path]; ok {
+			continue
+		}
+		fmt.Fprintln(os.Stderr, "remove:", path)
+		checkError(os.Remove(path))
+	}
 }
 
 func diff(v1 string, v2 string) string {
@@ -196,30 +445,50 @@ TODO カラム削除時に関連するIndex, FKのAlterクエリは吐かない
 
 */
 func diffDefines(arg *DiffArg, newModel, oldModel *models.Models) (alter, revert string) {
-	alterBuf := bytes.NewBuffer(nil)
-	revertBuf := bytes.NewBuffer(nil)
+	alterMigration, revertMigration := diffMigrations(arg, newModel, oldModel)
+	return alterMigration.String(), revertMigration.String()
+}
+
+// diffDefinesの差分SQLをテーブルごとの文として返す
+func diffMigrations(arg *DiffArg, newModel, oldModel *models.Models) (alter, revert *migration) {
+	alter, revert = diffSchemaMigrations(arg, newModel, oldModel)
+
+	//データ移行SQL
+	writeMigrationHooks([]*migration{alter}, []*migration{revert}, newModel)
+	return
+}
+
+// データ移行SQLを含まない差分SQL
+func diffSchemaMigrations(arg *DiffArg, newModel, oldModel *models.Models) (alter, revert *migration) {
+	alter = newMigration()
+	revert = newMigration()
+	for _, m := range []*migration{alter, revert} {
+		m.ExplainAlgorithm = arg.ExplainAlgorithm
+		m.AlgorithmClause = arg.AlgorithmClause
+	}
 
 	//テーブル追加/削除
 	addTables, dropTables, remainTableNames := diffTableByName(newModel, oldModel)
-	for _, t := range dropTables {
-		alterBuf.WriteString(t.ToDropSQL())
-	}
-	for _, t := range addTables {
-		revertBuf.WriteString(t.ToDropSQL())
-	}
-	for _, t := range dropTables {
-		revertBuf.WriteString(t.ToCreateSQL(arg.ForeignKey, arg.JsonComment))
-	}
-	for _, t := range addTables {
-		alterBuf.WriteString(t.ToCreateSQL(arg.ForeignKey, arg.JsonComment))
-	}
+	// 外部キーの依存順に作成し、逆順に削除する
+	addOrder := models.SortTablesByDependency(addTables)
+	dropOrder := models.SortTablesByDependency(dropTables)
+	writeDropTables(alter, dropOrder, arg)
+	writeDropTables(revert, addOrder, arg)
+	writeCreateTables(revert, dropOrder, arg)
+	writeCreateTables(alter, addOrder, arg)
 	//テーブル変更
 	for _, name := range remainTableNames {
 		newTable := newModel.GetTable(name)
 		oldTable := oldModel.GetTable(name)
 		if oldTable.IsChange(newTable) {
-			alterBuf.WriteString(newTable.ToAlterSQL())
-			revertBuf.WriteString(oldTable.ToAlterSQL())
+			alter.WriteAlter(name, newTable.ToAlterSQL(), predictTableOption(oldTable, newTable))
+			revert.WriteAlter(name, oldTable.ToAlterSQL(), predictTableOption(newTable, oldTable))
+		}
+		if oldTable.IsChangeAutoIncrement(newTable) {
+			alter.WriteAlter(name, newTable.ToAutoIncrementSQL(), predictAutoIncrement())
+			if oldTable.AutoIncrement != 0 {
+				revert.WriteAlter(name, oldTable.ToAutoIncrementSQL(), predictAutoIncrement())
+			}
 		}
 	}
 
@@ -231,18 +500,27 @@ func diffDefines(arg *DiffArg, newModel, oldModel *models.Models) (alter, revert
 		adds, drops, _, renames := diffColumnByDefine(newTable, oldTable)
 
 		for _, r := range renames {
-			alterBuf.WriteString(r.Old.ToRenameSQL(tableName, r.New))
-			revertBuf.WriteString(r.New.ToRenameSQL(tableName, r.Old))
+			alter.WriteColumnAlter(tableName, r.New.Name.LowerSnake(), r.Old.ToRenameSQL(tableName, r.New), predictRenameColumn())
+			revert.WriteColumnAlter(tableName, r.New.Name.LowerSnake(), r.New.ToRenameSQL(tableName, r.Old), predictRenameColumn())
+		}
+		// 追加時点のカラム並び(INSTANTの判定用)
+		revertColumns := stringSlice(newTable.GetColumnNames())
+		alterColumns := stringSlice(oldTable.GetColumnNames())
+		for _, r := range renames {
+			revertColumns[revertColumns.index(r.New.Name.LowerSnake())] = r.Old.Name.LowerSnake()
+			alterColumns[alterColumns.index(r.Old.Name.LowerSnake())] = r.New.Name.LowerSnake()
 		}
 		for _, c := range drops {
 			// 日付型, NOT NULLの場合の仮のデフォルト値を自動で設定する TODO オプションで切り替える？
-			//revertBuf.WriteString(c.ToAddSQLWithDummyDefault(tableName))
-			revertBuf.WriteString(c.ToAddSQL(tableName))
+			//revert.Write(tableName, c.ToAddSQLWithDummyDefault(tableName))
+			sql, algorithm := toAddColumnSQL(tableName, c, &revertColumns, newTable)
+			revert.WriteAlter(tableName, sql, algorithm)
 		}
 		for _, c := range adds {
 			// 日付型, NOT NULLの場合の仮のデフォルト値を自動で設定する TODO オプションで切り替える？
-			//alterBuf.WriteString(c.ToAddSQLWithDummyDefault(tableName))
-			alterBuf.WriteString(c.ToAddSQL(tableName))
+			//alter.Write(tableName, c.ToAddSQLWithDummyDefault(tableName))
+			sql, algorithm := toAddColumnSQL(tableName, c, &alterColumns, oldTable)
+			alter.WriteColumnAlter(tableName, c.Name.LowerSnake(), sql, algorithm)
 		}
 	}
 
@@ -250,7 +528,13 @@ func diffDefines(arg *DiffArg, newModel, oldModel *models.Models) (alter, revert
 	for _, tableName := range remainTableNames {
 		newTable := newModel.GetTable(tableName)
 		oldTable := oldModel.GetTable(tableName)
-		adds, drops, modifyNames := diffIndexBySQL(newTable, oldTable)
+		adds, drops, modifyNames, renames := diffIndexBySQL(newTable, oldTable)
+
+		// リネームは再作成しないため外部キーの削除も不要
+		for _, r := range renames {
+			alter.WriteAlter(tableName, r.Old.ToRenameSQL(tableName, r.New), predictRenameIndex())
+			revert.WriteAlter(tableName, r.New.ToRenameSQL(tableName, r.Old), predictRenameIndex())
+		}
 
 		allAddIndexes := make([]*models.Index, 0)
 		allDropIndexes := make([]*models.Index, 0)
@@ -259,6 +543,13 @@ func diffDefines(arg *DiffArg, newModel, oldModel *models.Models) (alter, revert
 			newIndex := newTable.GetIndex(indexName)
 			oldIndex := oldTable.GetIndex(indexName)
 
+			// 可視性のみの変更は再作成しない
+			if models.TargetVersion.SupportsInvisibleIndex() && newIndex.IsSameIgnoringVisibility(oldIndex) {
+				alter.WriteAlter(tableName, newIndex.ToVisibilitySQL(tableName), predictIndexVisibility())
+				revert.WriteAlter(tableName, oldIndex.ToVisibilitySQL(tableName), predictIndexVisibility())
+				continue
+			}
+
 			allDropIndexes = append(allDropIndexes, oldIndex)
 			allAddIndexes = append(allAddIndexes, newIndex)
 		}
@@ -266,49 +557,50 @@ func diffDefines(arg *DiffArg, newModel, oldModel *models.Models) (alter, revert
 		allDropIndexes = append(allDropIndexes, drops...)
 		allAddIndexes = append(allAddIndexes, adds...)
 
-		dropFkColumns := make(map[*models.Column]bool)
-		addFkColumns := make(map[*models.Column]bool)
+		// 出力順を固定するためインデックスの定義順に保持する
+		dropFkColumns := make([]*models.Column, 0)
+		addFkColumns := make([]*models.Column, 0)
 
 		// index対象の先頭カラムがFKを持つ場合、暗黙indexが削除されている可能性があるためFKを一旦削除する
 		for _, in := range allDropIndexes {
-			if in.Columns[0].Reference == "" {
+			if in.Columns[0].Reference == "" || containsColumn(dropFkColumns, in.Columns[0]) {
 				continue
 			}
-			dropFkColumns[in.Columns[0]] = true
+			dropFkColumns = append(dropFkColumns, in.Columns[0])
 		}
 		for _, in := range allAddIndexes {
-			if in.Columns[0].Reference == "" {
+			if in.Columns[0].Reference == "" || containsColumn(addFkColumns, in.Columns[0]) {
 				continue
 			}
-			addFkColumns[in.Columns[0]] = true
+			addFkColumns = append(addFkColumns, in.Columns[0])
 		}
 
 		// alter SQL出力
-		for c, _ := range dropFkColumns {
-			alterBuf.WriteString(c.ToFKDropSQL(tableName))
+		for _, c := range dropFkColumns {
+			alter.WriteAlter(tableName, c.ToFKDropSQL(tableName), predictDropForeignKey())
 		}
 		for _, in := range allDropIndexes {
-			alterBuf.WriteString(in.ToDropSQL(tableName))
+			alter.WriteAlter(tableName, in.ToDropSQL(tableName), predictDropIndex())
 		}
 		for _, in := range allAddIndexes {
-			alterBuf.WriteString(in.ToAddSQL(tableName))
+			alter.WriteAlter(tableName, in.ToAddSQL(tableName), predictAddIndex(in))
 		}
-		for c, _ := range dropFkColumns {
-			alterBuf.WriteString(c.ToFKAddSQL(tableName))
+		for _, c := range dropFkColumns {
+			alter.WriteAlter(tableName, c.ToFKAddSQL(tableName), predictAddForeignKey())
 		}
 
 		// revert SQL出力
-		for c, _ := range addFkColumns {
-			revertBuf.WriteString(c.ToFKDropSQL(tableName))
+		for _, c := range addFkColumns {
+			revert.WriteAlter(tableName, c.ToFKDropSQL(tableName), predictDropForeignKey())
 		}
 		for _, in := range allAddIndexes {
-			revertBuf.WriteString(in.ToDropSQL(tableName))
+			revert.WriteAlter(tableName, in.ToDropSQL(tableName), predictDropIndex())
 		}
 		for _, in := range allDropIndexes {
-			revertBuf.WriteString(in.ToAddSQL(tableName))
+			revert.WriteAlter(tableName, in.ToAddSQL(tableName), predictAddIndex(in))
 		}
-		for c, _ := range addFkColumns {
-			revertBuf.WriteString(c.ToFKAddSQL(tableName))
+		for _, c := range addFkColumns {
+			revert.WriteAlter(tableName, c.ToFKAddSQL(tableName), predictAddForeignKey())
 		}
 	}
 
@@ -320,16 +612,16 @@ func diffDefines(arg *DiffArg, newModel, oldModel *models.Models) (alter, revert
 			adds, drops := diffRef(newTable, oldTable)
 
 			for _, c := range drops {
-				alterBuf.WriteString(c.ToFKDropSQL(tableName))
+				alter.WriteAlter(tableName, c.ToFKDropSQL(tableName), predictDropForeignKey())
 			}
 			for _, c := range adds {
-				revertBuf.WriteString(c.ToFKDropSQL(tableName))
+				revert.WriteAlter(tableName, c.ToFKDropSQL(tableName), predictDropForeignKey())
 			}
 			for _, c := range drops {
-				revertBuf.WriteString(c.ToFKAddSQL(tableName))
+				revert.WriteAlter(tableName, c.ToFKAddSQL(tableName), predictAddForeignKey())
 			}
 			for _, c := range adds {
-				alterBuf.WriteString(c.ToFKAddSQL(tableName))
+				alter.WriteAlter(tableName, c.ToFKAddSQL(tableName), predictAddForeignKey())
 			}
 		}
 	}
@@ -343,12 +635,12 @@ func diffDefines(arg *DiffArg, newModel, oldModel *models.Models) (alter, revert
 		adds, drops, _, _ := diffColumnByDefine(newTable, oldTable)
 		for _, c := range drops {
 			if c.Reference != "" {
-				alterBuf.WriteString(c.ToFKDropSQL(tableName))
+				alter.WriteAlter(tableName, c.ToFKDropSQL(tableName), predictDropForeignKey())
 			}
-			alterBuf.WriteString(c.ToDropSQL(tableName))
+			alter.WriteAlter(tableName, c.ToDropSQL(tableName), predictDropColumn())
 		}
 		for _, c := range adds {
-			revertBuf.WriteString(c.ToDropSQL(tableName))
+			revert.WriteColumnAlter(tableName, c.Name.LowerSnake(), c.ToDropSQL(tableName), predictDropColumn())
 		}
 	}
 
@@ -366,33 +658,129 @@ func diffDefines(arg *DiffArg, newModel, oldModel *models.Models) (alter, revert
 			changeRes := oldColumn.IsChange(newColumn)
 			if changeRes != models.ColumnChangeType_Same {
 				//fmt.Println("column chnaged:", tableName, columnName, changeRes)
-				alterBuf.WriteString(newColumn.ToModifySQL(tableName, ""))
-				revertBuf.WriteString(oldColumn.ToModifySQL(tableName, ""))
+				alter.WriteColumnAlter(tableName, columnName, newColumn.ToModifySQL(tableName, ""), predictModifyColumn(oldColumn, newColumn))
+				revert.WriteColumnAlter(tableName, columnName, oldColumn.ToModifySQL(tableName, ""), predictModifyColumn(newColumn, oldColumn))
 			}
 		}
 
 		// カラム並び順の変更適用
-		for _, moveOp := range getMoveOps(newTable, oldTable) {
-			if moveOp.After != "" {
-				alterBuf.WriteString(newTable.GetColumn(moveOp.Column).ToModifySQL(tableName, "AFTER "+moveOp.After))
-			} else {
-				alterBuf.WriteString(newTable.GetColumn(moveOp.Column).ToModifySQL(tableName, "FIRST"))
-			}
+		if !arg.IgnoreColumnOrder {
+			alter.WriteAlter(tableName, toMoveColumnsSQL(tableName, newTable, getMoveOps(newTable, oldTable)), predictMoveColumn())
+			revert.WriteAlter(tableName, toMoveColumnsSQL(tableName, oldTable, getMoveOps(oldTable, newTable)), predictMoveColumn())
 		}
-		for _, moveOp := range getMoveOps(oldTable, newTable) {
-			if moveOp.After != "" {
-				revertBuf.WriteString(oldTable.GetColumn(moveOp.Column).ToModifySQL(tableName, "AFTER "+moveOp.After))
 
-			} else {
-				revertBuf.WriteString(oldTable.GetColumn(moveOp.Column).ToModifySQL(tableName, "FIRST"))
-			}
+	}
+	return
+}
+
+// 並び順の変更をまとめた1文(変更がなければ空)
+func toMoveColumnsSQL(tableName string, table *models.Table, moveOps []moveOperation) string {
+	if len(moveOps) == 0 {
+		return ""
+	}
+	columns := make([]*models.Column, 0)
+	orders := make([]string, 0)
+	for _, moveOp := range moveOps {
+		columns = append(columns, table.GetColumn(moveOp.Column))
+		if moveOp.After != "" {
+			orders = append(orders, "AFTER "+moveOp.After)
+		} else {
+			orders = append(orders, "FIRST")
 		}
+	}
+	return models.ToMoveColumnsSQL(tableName, columns, orders)
+}
 
+// 指定がなければ比較元データベースのバージョンを使用する
+func setTargetVersion(version string, oldModel *models.Models) {
+	if version == "" {
+		version = oldModel.MysqlVersion
 	}
+	if version == "" {
+		models.TargetVersion = models.DefaultMysqlVersion
+		return
+	}
+	models.TargetVersion = models.ParseMysqlVersion(version)
+}
 
-	alter = alterBuf.String()
-	revert = revertBuf.String()
-	return
+// alter文の末尾にALGORITHM等の指定を追加する
+func withAlterOption(sql string, option string) string {
+	return strings.TrimSuffix(sql, ";\n") + ", " + option + ";\n"
+}
+
+/**
+カラム追加のalter文とALGORITHMの予測
+columnsは追加時点のカラム並びで、追加後の並びに更新する
+tableは追加時点(インデックス変更前)のテーブル定義
+*/
+func toAddColumnSQL(tableName string, c *models.Column, columns *stringSlice, table *models.Table) (string, *alterAlgorithm) {
+	after := ""
+	if c.PreColumn != nil {
+		after = c.PreColumn.Name.LowerSnake()
+	}
+	trailing := len(*columns) == 0 || (*columns)[len(*columns)-1] == after
+	if after == "" {
+		*columns = columns.insert(0, c.Name.LowerSnake())
+	} else {
+		*columns = columns.insert(columns.index(after)+1, c.Name.LowerSnake())
+	}
+
+	sql := c.ToAddSQL(tableName)
+	instant := models.TargetVersion.SupportsInstantAddColumn(trailing) && !hasFulltextIndex(table)
+	if instant {
+		sql = withAlterOption(sql, "ALGORITHM=INSTANT")
+	}
+	return sql, predictAddColumn(instant, hasFulltextIndex(table))
+}
+
+// FULLTEXTインデックスを持つテーブルはINSTANTでカラム追加できない
+func hasFulltextIndex(t *models.Table) bool {
+	for _, in := range t.Indexes {
+		if strings.ToUpper(in.Type) == "FULLTEXT" {
+			return true
+		}
+	}
+	return false
+}
+
+func writeCreateTables(m *migration, order *models.TableOrder, arg *DiffArg) {
+	for _, t := range order.Tables {
+		if arg.ForeignKey {
+			m.Write(t.Name.LowerSnake(), t.ToCreateSQLWithRefs(arg.JsonComment, order.GetImmediateRefColumns(t)))
+		} else {
+			m.Write(t.Name.LowerSnake(), t.ToCreateSQL(false, arg.JsonComment))
+		}
+	}
+	if !arg.ForeignKey || len(order.Deferred) == 0 {
+		return
+	}
+
+	// 循環参照/自己参照の外部キーは全テーブル作成後に追加
+	for _, cycle := range order.GetCycleNames() {
+		fmt.Fprintln(os.Stderr, "circular foreign key reference:", cycle)
+		m.Write("", "-- circular foreign key reference: "+cycle+"\n")
+	}
+	for _, ref := range order.Deferred {
+		tableName := ref.From.Table.Name.LowerSnake()
+		m.Write(tableName, ref.From.Column.ToFKAddSQL(tableName))
+	}
+	m.Write("", "\n")
+}
+
+func writeDropTables(m *migration, order *models.TableOrder, arg *DiffArg) {
+	// 循環参照の外部キーを先に削除
+	if arg.ForeignKey {
+		for _, ref := range order.Deferred {
+			if ref.From.Table == ref.To.Table {
+				continue
+			}
+			tableName := ref.From.Table.Name.LowerSnake()
+			m.Write(tableName, ref.From.Column.ToFKDropSQL(tableName))
+		}
+	}
+	for i := len(order.Tables) - 1; 0 <= i; i-- {
+		m.Write(order.Tables[i].Name.LowerSnake(), order.Tables[i].ToDropSQL())
+	}
 }
 
 // =============================================
@@ -501,41 +889,80 @@ func containsOld(renameOperations []renameOperation, column *models.Column) bool
 	return false
 }
 
-func diffIndexBySQL(new, old *models.Table) (adds, drops []*models.Index, modifyNames []string) {
+func diffIndexBySQL(new, old *models.Table) (adds, drops []*models.Index, modifyNames []string, renames []indexRenameOperation) {
 	adds = make([]*models.Index, 0)
 	drops = make([]*models.Index, 0)
 	modifyNames = make([]string, 0)
+	renames = make([]indexRenameOperation, 0)
 
-	news := make(map[string]*models.Index)
-	olds := make(map[string]*models.Index)
+	news := make(map[string]bool)
+	olds := make(map[string]bool)
 
 	for _, newIndex := range new.Indexes {
-		news[newIndex.ToCreateSQL()] = newIndex
+		news[newIndex.ToCreateSQL()] = true
 	}
 	for _, oldIndex := range old.Indexes {
-		olds[oldIndex.ToCreateSQL()] = oldIndex
+		olds[oldIndex.ToCreateSQL()] = true
 	}
 
-	for newSQL, newIndex := range news {
-		if _, ok := olds[newSQL]; !ok {
-			if old.GetIndex(newIndex.Name) == nil {
-				adds = append(adds, newIndex)
-			} else {
-				modifyNames = append(modifyNames, newIndex.Name)
-			}
+	// 出力順を固定するため定義順に走査する
+	for _, newIndex := range new.Indexes {
+		if olds[newIndex.ToCreateSQL()] {
+			continue
+		}
+		if old.GetIndex(newIndex.Name) == nil {
+			adds = append(adds, newIndex)
+		} else if !contains(modifyNames, newIndex.Name) {
+			modifyNames = append(modifyNames, newIndex.Name)
+		}
+	}
+
+	for _, oldIndex := range old.Indexes {
+		if news[oldIndex.ToCreateSQL()] {
+			continue
+		}
+		if new.GetIndex(oldIndex.Name) == nil {
+			drops = append(drops, oldIndex)
 		}
 	}
 
-	for oldSQL, oldIndex := range olds {
-		if _, ok := news[oldSQL]; !ok {
-			if new.GetIndex(oldIndex.Name) == nil {
-				drops = append(drops, oldIndex)
+	if !models.TargetVersion.SupportsRenameIndex() {
+		return
+	}
+	// 名前以外が同一の追加/削除はリネーム
+	remainAdds := make([]*models.Index, 0)
+	for _, newIndex := range adds {
+		renamed := false
+		for i, oldIndex := range drops {
+			if oldIndex.IsSameIgnoringName(newIndex) {
+				renames = append(renames, indexRenameOperation{Old: oldIndex, New: newIndex})
+				drops = append(drops[:i], drops[i+1:]...)
+				renamed = true
+				break
 			}
 		}
+		if !renamed {
+			remainAdds = append(remainAdds, newIndex)
+		}
 	}
+	adds = remainAdds
 	return
 }
 
+type indexRenameOperation struct {
+	Old *models.Index
+	New *models.Index
+}
+
+func containsColumn(columns []*models.Column, c *models.Column) bool {
+	for _, v := range columns {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
 func diffRef(new, old *models.Table) (adds, drops []*models.Column) {
 	adds = make([]*models.Column, 0)
 	drops = make([]*models.Column, 0)
@@ -603,10 +1030,14 @@ type moveOperation struct {
 	After  string
 }
 
+/**
+カラム並び順の変更
+追加/削除を適用した並びと新しい並びの最長共通部分列(LCS)は動かさず、それ以外のカラムのみを
+新しい並び順に直前のカラムの後ろへ移動する(先頭から順に適用する)
+*/
 func getMoveOps(newTable, oldTable *models.Table) []moveOperation {
 	res := make([]moveOperation, 0)
 
-	//from := stringSlice(oldTable.GetColumnNames())
 	to := stringSlice(newTable.GetColumnNames())
 	cache := stringSlice(oldTable.GetColumnNames())
 
@@ -631,33 +1062,53 @@ func getMoveOps(newTable, oldTable *models.Table) []moveOperation {
 	}
 
 	// 移動
-	for !cache.equals(to) {
-		for _, v := range cache {
-			from_i := cache.index(v)
-			from_prev := ""
-			if from_i != 0 {
-				from_prev = cache[from_i-1]
-			}
-			to_i := to.index(v)
-			to_prev := ""
-			if to_i != 0 {
-				to_prev = to[to_i-1]
-			}
+	stays := longestCommonSubsequence(cache, to)
+	for i, v := range to {
+		if stays.index(v) != -1 {
+			continue
+		}
+		after := ""
+		if i != 0 {
+			after = to[i-1]
+		}
+		res = append(res, moveOperation{
+			Column: v,
+			After:  after,
+		})
+	}
+
+	return res
+}
 
-			if from_prev != to_prev {
-				res = append(res, moveOperation{
-					Column: v,
-					After:  to_prev,
-				})
-				cache = cache.delete(v)
-				if to_prev != "" {
-					cache = cache.insert(cache.index(to_prev)+1, v)
-				} else {
-					cache = cache.insert(0, v)
-				}
+func longestCommonSubsequence(a, b stringSlice) stringSlice {
+	// lengths[i][j]: a[i:]とb[j:]のLCSの長さ
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; 0 <= i; i-- {
+		for j := len(b) - 1; 0 <= j; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
 			}
 		}
 	}
 
+	res := make(stringSlice, 0)
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		if a[i] == b[j] {
+			res = append(res, a[i])
+			i++
+			j++
+		} else if lengths[i+1][j] >= lengths[i][j+1] {
+			i++
+		} else {
+			j++
+		}
+	}
 	return res
 }
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+)
+
+/**
+alter文に対してMySQL(InnoDB)が選択するALGORITHMとLOCKの予測
+TargetVersionと変更内容から判定する
+*/
+type alterAlgorithm struct {
+	Algorithm string
+	Lock      string
+	// テーブルの再構築を伴うか
+	Rebuild bool
+	Reason  string
+}
+
+func (this alterAlgorithm) Label() string {
+	res := "ALGORITHM=" + this.Algorithm
+	if this.Lock != "" {
+		res += ", LOCK=" + this.Lock
+	}
+	if this.Rebuild {
+		res += " (rebuild)"
+	}
+	return res + ": " + this.Reason
+}
+
+// ALGORITHM=INSTANTにはLOCKを指定できない
+func (this alterAlgorithm) Clause() string {
+	if this.Lock == "" {
+		return "ALGORITHM=" + this.Algorithm
+	}
+	return "ALGORITHM=" + this.Algorithm + ", LOCK=" + this.Lock
+}
+
+func instantAlgorithm(reason string) *alterAlgorithm {
+	return &alterAlgorithm{Algorithm: "INSTANT", Reason: reason}
+}
+
+func inplaceAlgorithm(rebuild bool, reason string) *alterAlgorithm {
+	return &alterAlgorithm{Algorithm: "INPLACE", Lock: "NONE", Rebuild: rebuild, Reason: reason}
+}
+
+func copyAlgorithm(reason string) *alterAlgorithm {
+	return &alterAlgorithm{Algorithm: "COPY", Lock: "SHARED", Rebuild: true, Reason: reason}
+}
+
+// 8.0以降はメタデータのみの変更がINSTANT
+func metadataOnlyAlgorithm(reason string) *alterAlgorithm {
+	if models.TargetVersion.AtLeast(8, 0, 12) {
+		return instantAlgorithm(reason)
+	}
+	return inplaceAlgorithm(false, reason)
+}
+
+/**
+ENGINE, DEFAULT CHARSET, COMMENTをまとめて指定するため常に再構築される
+	ENGINE, DEFAULT CHARSET(COLLATE)の変更はINPLACEにできない
+*/
+func predictTableOption(oldTable, newTable *models.Table) *alterAlgorithm {
+	if !strings.EqualFold(oldTable.Engine, newTable.Engine) {
+		return copyAlgorithm("change engine")
+	}
+	if !strings.EqualFold(oldTable.DefaultCharset, newTable.DefaultCharset) || !strings.EqualFold(oldTable.DefaultCollation, newTable.DefaultCollation) {
+		return copyAlgorithm("change charset")
+	}
+	return inplaceAlgorithm(true, "change comment (rebuild by ENGINE)")
+}
+
+func predictAutoIncrement() *alterAlgorithm {
+	return inplaceAlgorithm(false, "change auto_increment value")
+}
+
+func predictAddColumn(instant bool, hasFulltext bool) *alterAlgorithm {
+	if instant {
+		return instantAlgorithm("add column")
+	}
+	if hasFulltext {
+		return copyAlgorithm("add column to table with FULLTEXT index")
+	}
+	return inplaceAlgorithm(true, "add column")
+}
+
+func predictDropColumn() *alterAlgorithm {
+	if models.TargetVersion.AtLeast(8, 0, 29) {
+		return instantAlgorithm("drop column")
+	}
+	return inplaceAlgorithm(true, "drop column")
+}
+
+func predictRenameColumn() *alterAlgorithm {
+	if models.TargetVersion.AtLeast(8, 0, 28) {
+		return instantAlgorithm("rename column")
+	}
+	return inplaceAlgorithm(false, "rename column")
+}
+
+func predictModifyColumn(oldColumn, newColumn *models.Column) *alterAlgorithm {
+	changeTypes := oldColumn.ChangeTypes(newColumn)
+	for _, changeType := range changeTypes {
+		switch changeType {
+		case models.ColumnChangeType_Type:
+			if isVarcharExtension(oldColumn, newColumn) {
+				return inplaceAlgorithm(false, "extend varchar within the same length bytes")
+			}
+			return copyAlgorithm("change column type")
+		case models.ColumnChangeType_Extra:
+			return copyAlgorithm("change column extra")
+		}
+	}
+	for _, changeType := range changeTypes {
+		if changeType == models.ColumnChangeType_NotNull {
+			return inplaceAlgorithm(true, "change column nullability")
+		}
+	}
+	return metadataOnlyAlgorithm("change column default/comment")
+}
+
+func predictMoveColumn() *alterAlgorithm {
+	return inplaceAlgorithm(true, "reorder column")
+}
+
+func predictAddIndex(in *models.Index) *alterAlgorithm {
+	switch strings.ToUpper(in.Type) {
+	case "FULLTEXT", "SPATIAL":
+		return &alterAlgorithm{Algorithm: "INPLACE", Lock: "SHARED", Reason: "add " + strings.ToLower(in.Type) + " index"}
+	}
+	return inplaceAlgorithm(false, "add index")
+}
+
+func predictDropIndex() *alterAlgorithm {
+	return inplaceAlgorithm(false, "drop index")
+}
+
+func predictRenameIndex() *alterAlgorithm {
+	return metadataOnlyAlgorithm("rename index")
+}
+
+func predictIndexVisibility() *alterAlgorithm {
+	return metadataOnlyAlgorithm("change index visibility")
+}
+
+// SQL_PREFIXでFOREIGN_KEY_CHECKS=0としているためINPLACE
+func predictAddForeignKey() *alterAlgorithm {
+	return inplaceAlgorithm(false, "add foreign key (foreign_key_checks=0)")
+}
+
+func predictDropForeignKey() *alterAlgorithm {
+	return inplaceAlgorithm(false, "drop foreign key")
+}
+
+var varcharPattern = regexp.MustCompile(`^varchar\((\d+)\)`)
+var characterSetPattern = regexp.MustCompile(`(?i)character set (\w+)`)
+
+/**
+varcharの拡張で、長さバイト数(1 or 2byte)が変わらないか
+長さバイト数が変わる場合はCOPYになる
+*/
+func isVarcharExtension(oldColumn, newColumn *models.Column) bool {
+	oldMatch := varcharPattern.FindStringSubmatch(oldColumn.Type)
+	newMatch := varcharPattern.FindStringSubmatch(newColumn.Type)
+	if oldMatch == nil || newMatch == nil {
+		return false
+	}
+	// 長さ以外(charset等)は同一であること
+	if varcharPattern.ReplaceAllString(oldColumn.Type, "") != varcharPattern.ReplaceAllString(newColumn.Type, "") {
+		return false
+	}
+	oldLength, _ := strconv.Atoi(oldMatch[1])
+	newLength, _ := strconv.Atoi(newMatch[1])
+	if newLength < oldLength {
+		return false
+	}
+	maxBytes := charsetMaxBytes(columnCharset(newColumn))
+	return (oldLength*maxBytes <= 255) == (newLength*maxBytes <= 255)
+}
+
+func columnCharset(c *models.Column) string {
+	if m := characterSetPattern.FindStringSubmatch(c.Type); m != nil {
+		return m[1]
+	}
+	if c.Table != nil {
+		return c.Table.DefaultCharset
+	}
+	return ""
+}
+
+// 1文字の最大バイト数(不明な場合はutf8mb4とみなす)
+func charsetMaxBytes(charset string) int {
+	switch strings.ToLower(charset) {
+	case "latin1", "ascii", "binary":
+		return 1
+	case "ucs2":
+		return 2
+	case "utf8", "utf8mb3":
+		return 3
+	}
+	return 4
+}
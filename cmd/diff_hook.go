@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+)
+
+/**
+定義(MetaDataJson)のデータ移行SQLを、対象のテーブル/カラムの変更の前後に挿入する
+カラムは追加/変更/リネーム、テーブルは作成/変更(カラム, インデックス等を含む)される場合のみ
+alters, revertsは実行順のマイグレーション(--phasedではexpand, contract)で、
+preは最初に変更するマイグレーション、postは最後に変更するマイグレーションに1回だけ挿入する
+*/
+func writeMigrationHooks(alters, reverts []*migration, newModel *models.Models) {
+	for _, t := range newModel.Tables {
+		tableName := t.Name.LowerSnake()
+		for _, c := range t.Columns {
+			hook := c.GetMigrationHook()
+			if hook == nil {
+				continue
+			}
+			columnName := c.Name.LowerSnake()
+			match := func(st *migrationStatement) bool {
+				return st.Table == tableName && st.Column == columnName
+			}
+			writeMigrationHook(alters, reverts, match, tableName, tableName+"."+columnName, hook)
+		}
+
+		hook := t.GetMigrationHook()
+		if hook == nil {
+			continue
+		}
+		match := func(st *migrationStatement) bool {
+			return st.Table == tableName
+		}
+		writeMigrationHook(alters, reverts, match, tableName, tableName, hook)
+	}
+}
+
+func writeMigrationHook(alters, reverts []*migration, match func(st *migrationStatement) bool, tableName, label string, hook *models.MigrationHook) {
+	insertMigrationHook(alters, match,
+		newHookStatement(tableName, "pre-migration: "+label, hook.Pre),
+		newHookStatement(tableName, "post-migration: "+label, hook.Post))
+	insertMigrationHook(reverts, match,
+		newHookStatement(tableName, "pre-revert: "+label, hook.RevertPre),
+		newHookStatement(tableName, "post-revert: "+label, hook.RevertPost))
+}
+
+// 一致する文を含む最初のマイグレーションにpre, 最後のマイグレーションにpostを挿入する
+func insertMigrationHook(migrations []*migration, match func(st *migrationStatement) bool, pre, post *migrationStatement) {
+	first, last := -1, -1
+	for i, m := range migrations {
+		if m.Contains(match) {
+			if first == -1 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first == -1 {
+		return
+	}
+	if first == last {
+		migrations[first].InsertAround(match, pre, post)
+		return
+	}
+	migrations[first].InsertAround(match, pre, nil)
+	migrations[last].InsertAround(match, nil, post)
+}
+
+func newHookStatement(tableName, comment, sql string) *migrationStatement {
+	sql = strings.TrimSpace(sql)
+	if sql == "" {
+		return nil
+	}
+	if !strings.HasSuffix(sql, ";") {
+		sql += ";"
+	}
+	return &migrationStatement{
+		Table: tableName,
+		SQL:   "-- " + comment + "\n" + sql + "\n",
+	}
+}
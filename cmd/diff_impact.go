@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+)
+
+// テーブル再構築の処理速度の目安(bytes/sec)
+const (
+	inplaceRebuildRate = 64 << 20
+	copyRebuildRate    = 16 << 20
+)
+
+/**
+テーブル再構築を伴うalter文の影響の見積もり
+--oldがmysql dsnの場合のみSHOW TABLE STATUSの統計情報から算出する
+*/
+type tableImpact struct {
+	Rows        int64
+	DataLength  int64
+	IndexLength int64
+	// 再構築を伴う文の数
+	Rebuilds int
+	Copy     bool
+
+	EstimatedTime time.Duration
+	// 再構築中に必要な一時領域
+	RequiredDisk int64
+	// オンラインスキーマ変更ツール(gh-ost, pt-online-schema-change等)の使用を推奨
+	OnlineSchemaChange bool
+}
+
+func estimateTableImpact(table *models.Table, statements []*migrationStatement, oscThreshold int64) *tableImpact {
+	if table == nil || table.Stats == nil {
+		return nil
+	}
+	res := &tableImpact{
+		Rows:        table.Stats.Rows,
+		DataLength:  table.Stats.DataLength,
+		IndexLength: table.Stats.IndexLength,
+	}
+	size := table.Stats.TotalLength()
+	for _, st := range statements {
+		if st.Algorithm == nil || !st.Algorithm.Rebuild {
+			continue
+		}
+		res.Rebuilds++
+		rate := inplaceRebuildRate
+		if st.Algorithm.Algorithm == "COPY" {
+			res.Copy = true
+			rate = copyRebuildRate
+		}
+		res.EstimatedTime += time.Duration(float64(size) / float64(rate) * float64(time.Second))
+	}
+	if res.Rebuilds == 0 {
+		return nil
+	}
+	// 再構築は1文ずつ行われるため、テーブル1つ分のコピー領域
+	res.RequiredDisk = size
+	res.OnlineSchemaChange = 0 < oscThreshold && oscThreshold <= size
+	return res
+}
+
+func (this tableImpact) String() string {
+	algorithm := "INPLACE"
+	if this.Copy {
+		algorithm = "COPY"
+	}
+	return fmt.Sprintf("rebuild x%d (%s): rows ~%d, data %s, index %s, estimated %s, disk %s",
+		this.Rebuilds, algorithm, this.Rows, formatBytes(this.DataLength), formatBytes(this.IndexLength), this.FormatTime(), formatBytes(this.RequiredDisk))
+}
+
+func (this tableImpact) FormatTime() string {
+	if this.EstimatedTime < time.Second {
+		return "< 1s"
+	}
+	return "~" + this.EstimatedTime.Round(time.Second).String()
+}
+
+func formatBytes(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	v := float64(size)
+	i := 0
+	for 1024 <= v && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
+
+// 1024, 512K, 100M, 1G 等のサイズ指定
+func parseSize(v string) int64 {
+	v = strings.ToUpper(strings.TrimSpace(v))
+	if v == "" {
+		return 0
+	}
+	v = strings.TrimSuffix(v, "B")
+	shift := uint(0)
+	switch {
+	case strings.HasSuffix(v, "K"):
+		shift = 10
+	case strings.HasSuffix(v, "M"):
+		shift = 20
+	case strings.HasSuffix(v, "G"):
+		shift = 30
+	case strings.HasSuffix(v, "T"):
+		shift = 40
+	}
+	if shift != 0 {
+		v = v[:len(v)-1]
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		panic(fmt.Sprint("invalid size:", v))
+	}
+	return n << shift
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+)
+
+// 差分SQLの1文
+type migrationStatement struct {
+	Table string
+	// カラムの追加/変更/リネームの場合のみ
+	Column string
+	SQL    string
+	// alter文の場合のALGORITHM/LOCKの予測
+	Algorithm *alterAlgorithm
+}
+
+// ALGORITHM/LOCKの予測をコメント/句として付与したSQL
+func (this *migrationStatement) Render(explain bool, clause bool) string {
+	if this.Algorithm == nil {
+		return this.SQL
+	}
+	sql := this.SQL
+	// 既に指定済み(INSTANTのカラム追加等)の場合は付与しない
+	if clause && !strings.Contains(sql, "ALGORITHM=") {
+		sql = withAlterOption(sql, this.Algorithm.Clause())
+	}
+	if explain {
+		sql = "-- " + this.Algorithm.Label() + "\n" + sql
+	}
+	return sql
+}
+
+// 差分SQL(alter or revert)を出力順に保持する
+type migration struct {
+	Statements []*migrationStatement
+
+	// alter文にALGORITHM/LOCKの予測をコメントで付与する
+	ExplainAlgorithm bool
+	// alter文にALGORITHM/LOCK句を付与する
+	AlgorithmClause bool
+}
+
+func newMigration() *migration {
+	return &migration{
+		Statements: make([]*migrationStatement, 0),
+	}
+}
+
+// tableが空の文はテーブルに属さないコメント等
+func (this *migration) Write(table string, sql string) {
+	this.WriteAlter(table, sql, nil)
+}
+
+func (this *migration) WriteAlter(table string, sql string, algorithm *alterAlgorithm) {
+	this.WriteColumnAlter(table, "", sql, algorithm)
+}
+
+func (this *migration) WriteColumnAlter(table string, column string, sql string, algorithm *alterAlgorithm) {
+	if sql == "" {
+		return
+	}
+	this.Statements = append(this.Statements, &migrationStatement{
+		Table:     table,
+		Column:    column,
+		SQL:       sql,
+		Algorithm: algorithm,
+	})
+}
+
+func (this *migration) Contains(match func(st *migrationStatement) bool) bool {
+	for _, st := range this.Statements {
+		if match(st) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+条件に一致する最初の文の前にpre, 最後の文の後ろにpostを挿入する
+一致する文がなければ挿入しない
+*/
+func (this *migration) InsertAround(match func(st *migrationStatement) bool, pre, post *migrationStatement) {
+	first, last := -1, -1
+	for i, st := range this.Statements {
+		if match(st) {
+			if first == -1 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first == -1 {
+		return
+	}
+	res := make([]*migrationStatement, 0, len(this.Statements)+2)
+	res = append(res, this.Statements[:first]...)
+	if pre != nil {
+		res = append(res, pre)
+	}
+	res = append(res, this.Statements[first:last+1]...)
+	if post != nil {
+		res = append(res, post)
+	}
+	res = append(res, this.Statements[last+1:]...)
+	this.Statements = res
+}
+
+func (this *migration) String() string {
+	buf := bytes.NewBuffer(nil)
+	for _, st := range this.Statements {
+		buf.WriteString(st.Render(this.ExplainAlgorithm, this.AlgorithmClause))
+	}
+	return buf.String()
+}
+
+// 指定テーブルの文のみ
+func (this *migration) TableSQL(table string) string {
+	buf := bytes.NewBuffer(nil)
+	for _, st := range this.TableStatements(table) {
+		buf.WriteString(st.Render(this.ExplainAlgorithm, this.AlgorithmClause))
+	}
+	return buf.String()
+}
+
+func (this *migration) TableStatements(table string) []*migrationStatement {
+	res := make([]*migrationStatement, 0)
+	for _, st := range this.Statements {
+		if st.Table == table {
+			res = append(res, st)
+		}
+	}
+	return res
+}
@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+	"github.com/alfalfalfa/mysql_tool/util"
+)
+
+// 型変更時に一時的に追加するカラムの接尾辞
+const phasedColumnSuffix = "_new"
+
+/**
+expand/contractの2段階の差分
+expand
+	テーブル/カラム/インデックスの追加、変更を行い、削除はしない
+	リネームは新しいカラムを追加して旧カラムの値をコピー
+	型変更は新しい型の一時カラム(xxx_new)を追加して値をコピー
+	追加するカラムはデフォルト値のないNOT NULLであればNULL可とする(旧アプリケーションのINSERTのため)
+contract
+	リネーム前のカラム、型変更前のカラムの値を再度コピー(expand以降の書き込み)
+	削除されたテーブル/カラム、Deprecatedのカラム、リネーム前のカラムを削除
+	型変更は旧カラムを削除し、一時カラムを新しい定義でリネーム(カラムを含むインデックスは入れ替えの前後で再作成)
+	expandでNULL可としたカラムをNOT NULLにする
+データ移行SQLはテーブル/カラム毎に1回(preは最初、postは最後の変更の前後)
+主キー, AUTO_INCREMENTのカラムの型変更は段階に分けられないためエラー
+*/
+type phasedMigration struct {
+	ExpandAlter    *migration
+	ExpandRevert   *migration
+	ContractAlter  *migration
+	ContractRevert *migration
+}
+
+// 型変更するカラム
+type phasedTypeChange struct {
+	Table     string
+	OldColumn *models.Column
+	NewColumn *models.Column
+	// expandで追加する一時カラム
+	TmpColumn *models.Column
+	// expandでの旧カラム(contractのrevertで元の位置に戻す)
+	ExpandColumn *models.Column
+	// カラムを含むインデックス(入れ替えの前に削除して後に再作成)
+	Indexes []*models.Index
+}
+
+func diffPhased(arg *DiffArg, newModel, oldModel *models.Models) *phasedMigration {
+	res := &phasedMigration{}
+
+	expandTables := models.CloneTables(newModel.Tables)
+	swappedTables := models.CloneTables(newModel.Tables)
+	backfills := newMigration()
+	resyncs := newMigration()
+	revertBackfills := newMigration()
+	typeChanges := make([]*phasedTypeChange, 0)
+
+	//テーブル削除はcontract
+	_, dropTables, remainTableNames := diffTableByName(newModel, oldModel)
+	for _, t := range models.CloneTables(dropTables) {
+		expandTables = append(expandTables, t)
+		swappedTables = append(swappedTables, models.CloneTables([]*models.Table{t})...)
+	}
+
+	for _, tableName := range remainTableNames {
+		newTable := newModel.GetTable(tableName)
+		oldTable := oldModel.GetTable(tableName)
+		expandTable := findTable(expandTables, tableName)
+		swappedTable := findTable(swappedTables, tableName)
+
+		//追加するカラムはcontractまでNULL可
+		adds, drops, _, renames := diffColumnByDefine(newTable, oldTable)
+		for _, c := range adds {
+			relaxPhasedColumn(expandTable.GetColumn(c.Name.LowerSnake()))
+			relaxPhasedColumn(swappedTable.GetColumn(c.Name.LowerSnake()))
+		}
+
+		//カラム削除はcontract
+		for _, c := range drops {
+			insertPhasedColumn(expandTable, models.CloneColumn(c), oldTable)
+			insertPhasedColumn(swappedTable, models.CloneColumn(c), oldTable)
+			keepPhasedIndexes(expandTable, oldTable, c)
+			keepPhasedIndexes(swappedTable, oldTable, c)
+		}
+
+		//リネームは新カラムの追加と値のコピー、旧カラムの削除はcontract
+		for _, r := range renames {
+			insertPhasedColumn(expandTable, models.CloneColumn(r.Old), oldTable)
+			insertPhasedColumn(swappedTable, models.CloneColumn(r.Old), oldTable)
+			keepPhasedIndexes(expandTable, oldTable, r.Old)
+			keepPhasedIndexes(swappedTable, oldTable, r.Old)
+			relaxPhasedColumn(expandTable.GetColumn(r.New.Name.LowerSnake()))
+			relaxPhasedColumn(swappedTable.GetColumn(r.New.Name.LowerSnake()))
+			backfills.WriteColumnAlter(tableName, r.New.Name.LowerSnake(), toBackfillSQL(tableName, r.New, r.Old), nil)
+			resyncs.WriteColumnAlter(tableName, r.New.Name.LowerSnake(), toBackfillSQL(tableName, r.New, r.Old), nil)
+			revertBackfills.WriteColumnAlter(tableName, r.Old.Name.LowerSnake(), toBackfillSQL(tableName, r.Old, r.New), nil)
+		}
+
+		//型変更は一時カラムの追加と値のコピー、入れ替えはcontract
+		_, _, commonNames := diffColumnByName(newTable, oldTable)
+		for _, columnName := range commonNames {
+			newColumn := newTable.GetColumn(columnName)
+			oldColumn := oldTable.GetColumn(columnName)
+			if !containsChangeType(oldColumn.ChangeTypes(newColumn), models.ColumnChangeType_Type) {
+				continue
+			}
+			if oldColumn.PrimaryKey != 0 || newColumn.PrimaryKey != 0 || isAutoIncrement(oldColumn) || isAutoIncrement(newColumn) {
+				panic(fmt.Sprintf("--phased does not support changing the type of a primary key or auto_increment column: %s.%s", tableName, columnName))
+			}
+			tmpColumn := models.CloneColumn(newColumn)
+			tmpColumn.Name = util.NewCaseString(columnName + phasedColumnSuffix)
+			tmpColumn.PrimaryKey = 0
+			tmpColumn.Extra = ""
+			tmpColumn.Reference = ""
+			tmpColumn.MetaDataJson = ""
+			relaxPhasedColumn(tmpColumn)
+			expandColumn := models.CloneColumn(oldColumn)
+			replacePhasedColumn(expandTable, expandColumn)
+			insertPhasedColumnAfter(expandTable, tmpColumn, columnName)
+			backfills.WriteColumnAlter(tableName, tmpColumn.Name.LowerSnake(), toBackfillSQL(tableName, tmpColumn, oldColumn), nil)
+			resyncs.WriteColumnAlter(tableName, tmpColumn.Name.LowerSnake(), toBackfillSQL(tableName, tmpColumn, oldColumn), nil)
+			typeChanges = append(typeChanges, &phasedTypeChange{
+				Table:        tableName,
+				OldColumn:    oldColumn,
+				NewColumn:    newColumn,
+				TmpColumn:    tmpColumn,
+				ExpandColumn: expandColumn,
+				Indexes:      indexesContainColumn(newTable, columnName),
+			})
+		}
+	}
+
+	//Deprecatedのカラムはcontractで削除
+	contractTables := models.CloneTables(newModel.Tables)
+	for _, t := range contractTables {
+		removeDeprecatedColumns(t)
+	}
+
+	expandModel := models.NewModels(expandTables)
+	swappedModel := models.NewModels(swappedTables)
+	contractModel := models.NewModels(contractTables)
+
+	res.ExpandAlter, res.ExpandRevert = diffSchemaMigrations(arg, expandModel, oldModel)
+	res.ExpandAlter.Statements = append(res.ExpandAlter.Statements, backfills.Statements...)
+
+	res.ContractAlter = newMigration()
+	res.ContractRevert = newMigration()
+	for _, m := range []*migration{res.ContractAlter, res.ContractRevert} {
+		m.ExplainAlgorithm = arg.ExplainAlgorithm
+		m.AlgorithmClause = arg.AlgorithmClause
+	}
+	// expand以降に旧カラムへ書き込まれた値を再度コピー
+	res.ContractAlter.Statements = append(res.ContractAlter.Statements, resyncs.Statements...)
+	// 旧カラムを削除して一時カラムを新しい定義(NOT NULL等)でリネーム
+	// 旧カラムの削除でインデックスからカラムが除かれるため、インデックスは削除して再作成する
+	for _, change := range typeChanges {
+		for _, in := range change.Indexes {
+			res.ContractAlter.WriteAlter(change.Table, in.ToDropSQL(change.Table), predictDropIndex())
+		}
+		res.ContractAlter.WriteColumnAlter(change.Table, change.OldColumn.Name.LowerSnake(), change.OldColumn.ToDropSQL(change.Table), predictDropColumn())
+		res.ContractAlter.WriteColumnAlter(change.Table, change.NewColumn.Name.LowerSnake(), change.TmpColumn.ToChangeSQL(change.Table, change.NewColumn), predictSwapColumn(change.TmpColumn, change.NewColumn))
+		for _, in := range change.Indexes {
+			res.ContractAlter.WriteAlter(change.Table, in.ToAddSQL(change.Table), predictAddIndex(in))
+		}
+	}
+	contractAlter, contractRevert := diffSchemaMigrations(arg, contractModel, swappedModel)
+	res.ContractAlter.Statements = append(res.ContractAlter.Statements, contractAlter.Statements...)
+	res.ContractRevert.Statements = append(res.ContractRevert.Statements, contractRevert.Statements...)
+	res.ContractRevert.Statements = append(res.ContractRevert.Statements, revertBackfills.Statements...)
+	for _, change := range typeChanges {
+		for _, in := range change.Indexes {
+			res.ContractRevert.WriteAlter(change.Table, in.ToDropSQL(change.Table), predictDropIndex())
+		}
+		res.ContractRevert.WriteColumnAlter(change.Table, change.NewColumn.Name.LowerSnake(), change.NewColumn.ToChangeSQL(change.Table, change.TmpColumn), predictSwapColumn(change.NewColumn, change.TmpColumn))
+		res.ContractRevert.WriteColumnAlter(change.Table, change.OldColumn.Name.LowerSnake(), change.ExpandColumn.ToAddSQL(change.Table), predictAddColumn(false, false))
+		res.ContractRevert.WriteColumnAlter(change.Table, change.OldColumn.Name.LowerSnake(), toBackfillSQL(change.Table, change.OldColumn, change.TmpColumn), nil)
+		for _, in := range change.Indexes {
+			res.ContractRevert.WriteAlter(change.Table, in.ToAddSQL(change.Table), predictAddIndex(in))
+		}
+	}
+
+	writeMigrationHooks(
+		[]*migration{res.ExpandAlter, res.ContractAlter},
+		[]*migration{res.ContractRevert, res.ExpandRevert},
+		newModel)
+	return res
+}
+
+// カラムを含むインデックス(定義順)
+func indexesContainColumn(t *models.Table, columnName string) []*models.Index {
+	res := make([]*models.Index, 0)
+	for _, in := range t.Indexes {
+		if in.IsContainColumnName(columnName) {
+			res = append(res, in)
+		}
+	}
+	return res
+}
+
+// 一時カラムと入れ替えるカラムの定義の差(名前以外が同じであればリネームのみ)
+func predictSwapColumn(from, to *models.Column) *alterAlgorithm {
+	renamed := models.CloneColumn(from)
+	renamed.Name = to.Name
+	if len(renamed.ChangeTypes(to)) == 0 {
+		return predictRenameColumn()
+	}
+	return predictModifyColumn(renamed, to)
+}
+
+// デフォルト値のないNOT NULLのカラムをNULL可にする
+func relaxPhasedColumn(c *models.Column) {
+	if c.NotNull && !c.Default.Valid {
+		c.NotNull = false
+	}
+}
+
+func toBackfillSQL(tableName string, to, from *models.Column) string {
+	return "UPDATE `" + tableName + "` SET `" + to.Name.LowerSnake() + "` = `" + from.Name.LowerSnake() + "`;\n"
+}
+
+func findTable(tables []*models.Table, name string) *models.Table {
+	for _, t := range tables {
+		if t.Name.LowerSnake() == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func containsChangeType(changeTypes []models.ColumnChangeType, changeType models.ColumnChangeType) bool {
+	for _, v := range changeTypes {
+		if v == changeType {
+			return true
+		}
+	}
+	return false
+}
+
+// 旧定義での直前のカラムの後ろに追加する(なければ末尾)
+func insertPhasedColumn(t *models.Table, c *models.Column, oldTable *models.Table) {
+	after := ""
+	if pre := oldTable.GetColumn(c.Name.LowerSnake()).PreColumn; pre != nil {
+		after = pre.Name.LowerSnake()
+	}
+	insertPhasedColumnAfter(t, c, after)
+}
+
+func insertPhasedColumnAfter(t *models.Table, c *models.Column, after string) {
+	i := len(t.Columns)
+	if after == "" {
+		i = 0
+	} else {
+		for j, v := range t.Columns {
+			if v.Name.LowerSnake() == after {
+				i = j + 1
+				break
+			}
+		}
+	}
+	t.Columns = append(t.Columns[:i], append([]*models.Column{c}, t.Columns[i:]...)...)
+}
+
+func replacePhasedColumn(t *models.Table, c *models.Column) {
+	for i, v := range t.Columns {
+		if v.Name.LowerSnake() == c.Name.LowerSnake() {
+			t.Columns[i] = c
+		}
+	}
+}
+
+// 削除するカラムを含むインデックスはcontractまで維持する
+func keepPhasedIndexes(t *models.Table, oldTable *models.Table, c *models.Column) {
+	for _, in := range oldTable.Indexes {
+		if !in.IsContainColumnName(c.Name.LowerSnake()) || t.GetIndex(in.Name) != nil {
+			continue
+		}
+		keep := *in
+		keep.Columns = nil
+		t.Indexes = append(t.Indexes, &keep)
+	}
+}
+
+// 参照解決前の定義からDeprecatedのカラムと、それを含むインデックスを除く
+func removeDeprecatedColumns(t *models.Table) {
+	columns := make([]*models.Column, 0)
+	deprecated := make([]string, 0)
+	for _, c := range t.Columns {
+		if c.IsDeprecated() {
+			deprecated = append(deprecated, c.Name.LowerSnake())
+			continue
+		}
+		columns = append(columns, c)
+	}
+	t.Columns = columns
+
+	indexes := make([]*models.Index, 0)
+	for _, in := range t.Indexes {
+		contain := false
+		for _, name := range deprecated {
+			if in.IsContainColumnName(name) {
+				contain = true
+			}
+		}
+		if !contain {
+			indexes = append(indexes, in)
+		}
+	}
+	t.Indexes = indexes
+}
@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+)
+
+// レビュー用の変更レポート
+type report struct {
+	Tables      []*reportTable
+	Destructive int
+	// オンラインスキーマ変更ツールの使用を推奨するテーブル数
+	OnlineSchemaChange int
+	OscThreshold       string
+}
+
+type reportTable struct {
+	Name        string
+	Kind        string
+	Details     []string
+	Destructive []string
+	Columns     []*reportColumn
+	Indexes     []schemaChange
+	ForeignKeys []schemaChange
+	AlterSQL    string
+	RevertSQL   string
+	Impact      *tableImpact
+}
+
+type reportColumn struct {
+	Kind        string
+	Name        string
+	Type        string
+	Nullable    string
+	Default     string
+	Comment     string
+	Destructive bool
+}
+
+func newReport(changes []schemaChange, newModel, oldModel *models.Models, alter, revert *migration) *report {
+	res := &report{
+		Tables: make([]*reportTable, 0),
+	}
+	tables := make(map[string]*reportTable)
+	for _, c := range changes {
+		t, ok := tables[c.Table]
+		if !ok {
+			t = &reportTable{
+				Name:        c.Table,
+				Kind:        "changed",
+				Details:     make([]string, 0),
+				Destructive: make([]string, 0),
+				Columns:     make([]*reportColumn, 0),
+				Indexes:     make([]schemaChange, 0),
+				ForeignKeys: make([]schemaChange, 0),
+				AlterSQL:    strings.TrimSpace(alter.TableSQL(c.Table)),
+				RevertSQL:   strings.TrimSpace(revert.TableSQL(c.Table)),
+			}
+			tables[c.Table] = t
+			res.Tables = append(res.Tables, t)
+		}
+		if c.IsDestructive() {
+			t.Destructive = append(t.Destructive, c.String())
+			res.Destructive++
+		}
+
+		switch c.Object {
+		case "table":
+			switch c.Kind {
+			case "changed":
+				t.Details = append(t.Details, c.Detail)
+			case "added":
+				t.Kind = c.Kind
+				t.Columns = append(t.Columns, newReportTableColumns(newModel.GetTable(c.Table), c.Kind)...)
+			case "dropped":
+				t.Kind = c.Kind
+				t.Columns = append(t.Columns, newReportTableColumns(oldModel.GetTable(c.Table), c.Kind)...)
+			}
+		case "column":
+			t.Columns = append(t.Columns, newReportColumn(c))
+		case "index":
+			t.Indexes = append(t.Indexes, c)
+		case "foreign key":
+			t.ForeignKeys = append(t.ForeignKeys, c)
+		}
+	}
+	return res
+}
+
+// テーブル再構築の見積もり(統計情報がある場合のみ)
+func (this *report) EstimateImpact(oldModel *models.Models, alter *migration, oscThreshold int64) {
+	this.OscThreshold = formatBytes(oscThreshold)
+	for _, t := range this.Tables {
+		if t.Kind != "changed" {
+			continue
+		}
+		t.Impact = estimateTableImpact(oldModel.GetTable(t.Name), alter.TableStatements(t.Name), oscThreshold)
+		if t.Impact != nil && t.Impact.OnlineSchemaChange {
+			this.OnlineSchemaChange++
+		}
+	}
+}
+
+func newReportColumn(c schemaChange) *reportColumn {
+	res := &reportColumn{
+		Kind:        c.Kind,
+		Name:        c.Name,
+		Destructive: c.IsDestructive(),
+	}
+	old := c.OldColumn
+	new := c.NewColumn
+	if new == nil {
+		new = old
+	}
+	if old == nil {
+		old = new
+	}
+	if c.Kind == "renamed" {
+		res.Name = beforeAfter(old.Name.LowerSnake(), new.Name.LowerSnake())
+	}
+	if c.Kind == "moved" {
+		res.Type = c.Detail
+		return res
+	}
+	res.Type = beforeAfter(old.Type, new.Type)
+	res.Nullable = beforeAfter(describeNullable(old), describeNullable(new))
+	res.Default = beforeAfter(describeDefault(old), describeDefault(new))
+	res.Comment = beforeAfter(old.Comment, new.Comment)
+	return res
+}
+
+// 追加/削除されたテーブルの全カラム
+func newReportTableColumns(t *models.Table, kind string) []*reportColumn {
+	res := make([]*reportColumn, 0)
+	for _, c := range t.Columns {
+		res = append(res, &reportColumn{
+			Kind:        kind,
+			Name:        c.Name.LowerSnake(),
+			Type:        c.Type,
+			Nullable:    describeNullable(c),
+			Default:     describeDefault(c),
+			Comment:     c.Comment,
+			Destructive: kind == "dropped",
+		})
+	}
+	return res
+}
+
+func beforeAfter(before, after string) string {
+	if before == after {
+		return after
+	}
+	return before + " → " + after
+}
+
+func describeNullable(c *models.Column) string {
+	if c.NotNull {
+		return "NOT NULL"
+	}
+	return "NULL"
+}
+
+func mdCell(v string) string {
+	v = strings.Replace(v, "|", "\\|", -1)
+	return strings.Replace(v, "\n", " ", -1)
+}
+
+const markdownReportTemplate = `# Schema change report
+
+| Table | Change | Destructive | Rebuild |
+|---|---|---|---|
+{{range .Tables}}| ` + "`{{.Name}}`" + ` | {{.Kind}} | {{if .Destructive}}⚠ {{len .Destructive}}{{end}} | {{with .Impact}}{{.FormatTime}}{{if .OnlineSchemaChange}} ⚠{{end}}{{end}} |
+{{end}}
+{{if .Destructive}}> ⚠ **{{.Destructive}} destructive operation(s)**
+{{end}}
+{{if .OnlineSchemaChange}}> ⚠ **{{.OnlineSchemaChange}} table(s) over {{.OscThreshold}}: use an online schema change tool**
+{{end}}
+{{range .Tables}}
+## ` + "`{{.Name}}`" + ` ({{.Kind}})
+{{range .Details}}
+- {{md .}}
+{{- end}}
+{{range .Destructive}}
+> ⚠ **destructive**: {{md .}}
+{{end}}
+{{with .Impact}}
+> {{.}}
+{{if .OnlineSchemaChange}}>
+> ⚠ **online schema change recommended**
+{{end}}{{end}}
+{{if .Columns}}
+### Columns
+
+| Change | Column | Type | Nullable | Default | Comment |
+|---|---|---|---|---|---|
+{{range .Columns}}| {{if .Destructive}}⚠ **{{.Kind}}**{{else}}{{.Kind}}{{end}} | {{md .Name}} | {{md .Type}} | {{.Nullable}} | {{md .Default}} | {{md .Comment}} |
+{{end}}{{end}}
+{{if .Indexes}}
+### Indexes
+
+| Change | Index | Definition |
+|---|---|---|
+{{range .Indexes}}| {{.Kind}} | {{md .Name}} | {{md .Detail}} |
+{{end}}{{end}}
+{{if .ForeignKeys}}
+### Foreign keys
+
+| Change | Column | Reference |
+|---|---|---|
+{{range .ForeignKeys}}| {{.Kind}} | {{md .Name}} | {{md .Detail}} |
+{{end}}{{end}}
+{{if .AlterSQL}}
+<details><summary>SQL (up)</summary>
+
+` + "```sql" + `
+{{.AlterSQL}}
+` + "```" + `
+
+</details>
+{{end}}
+{{if .RevertSQL}}
+<details><summary>SQL (down)</summary>
+
+` + "```sql" + `
+{{.RevertSQL}}
+` + "```" + `
+
+</details>
+{{end}}
+{{end}}`
+
+const htmlReportTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Schema change report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin: 0.5em 0 1em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+th { background: #606060; color: #fff; }
+.destructive { background: #fdd; }
+.warning { color: #c00; font-weight: bold; }
+pre { background: #f6f6f6; padding: 0.5em; }
+</style>
+</head>
+<body>
+<h1>Schema change report</h1>
+<table>
+<tr><th>Table</th><th>Change</th><th>Destructive</th><th>Rebuild</th></tr>
+{{range .Tables}}<tr{{if .Destructive}} class="destructive"{{end}}><td><a href="#{{.Name}}">{{.Name}}</a></td><td>{{.Kind}}</td><td>{{if .Destructive}}{{len .Destructive}}{{end}}</td><td>{{with .Impact}}{{.FormatTime}}{{if .OnlineSchemaChange}} ⚠{{end}}{{end}}</td></tr>
+{{end}}</table>
+{{if .Destructive}}<p class="warning">⚠ {{.Destructive}} destructive operation(s)</p>{{end}}
+{{if .OnlineSchemaChange}}<p class="warning">⚠ {{.OnlineSchemaChange}} table(s) over {{.OscThreshold}}: use an online schema change tool</p>{{end}}
+{{range .Tables}}
+<h2 id="{{.Name}}">{{.Name}} ({{.Kind}})</h2>
+{{if .Details}}<ul>{{range .Details}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{range .Destructive}}<p class="warning">⚠ destructive: {{.}}</p>
+{{end}}
+{{with .Impact}}<p>{{.String}}</p>{{if .OnlineSchemaChange}}<p class="warning">⚠ online schema change recommended</p>{{end}}{{end}}
+{{if .Columns}}<h3>Columns</h3>
+<table>
+<tr><th>Change</th><th>Column</th><th>Type</th><th>Nullable</th><th>Default</th><th>Comment</th></tr>
+{{range .Columns}}<tr{{if .Destructive}} class="destructive"{{end}}><td>{{.Kind}}</td><td>{{.Name}}</td><td>{{.Type}}</td><td>{{.Nullable}}</td><td>{{.Default}}</td><td>{{.Comment}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Indexes}}<h3>Indexes</h3>
+<table>
+<tr><th>Change</th><th>Index</th><th>Definition</th></tr>
+{{range .Indexes}}<tr><td>{{.Kind}}</td><td>{{.Name}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>{{end}}
+{{if .ForeignKeys}}<h3>Foreign keys</h3>
+<table>
+<tr><th>Change</th><th>Column</th><th>Reference</th></tr>
+{{range .ForeignKeys}}<tr><td>{{.Kind}}</td><td>{{.Name}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>{{end}}
+{{if .AlterSQL}}<details><summary>SQL (up)</summary><pre>{{.AlterSQL}}</pre></details>{{end}}
+{{if .RevertSQL}}<details><summary>SQL (down)</summary><pre>{{.RevertSQL}}</pre></details>{{end}}
+{{end}}
+</body>
+</html>
+`
+
+var blankLines = regexp.MustCompile(`\n([ \t]*\n)+`)
+
+func (this *report) ToMarkdown() string {
+	tmpl := template.Must(template.New("report").Funcs(template.FuncMap{"md": mdCell}).Parse(markdownReportTemplate))
+	buf := bytes.NewBuffer(nil)
+	checkError(tmpl.Execute(buf, this))
+	// 連続した空行を詰める
+	return blankLines.ReplaceAllString(buf.String(), "\n\n")
+}
+
+func (this *report) ToHtml() string {
+	tmpl := htmltemplate.Must(htmltemplate.New("report").Parse(htmlReportTemplate))
+	buf := bytes.NewBuffer(nil)
+	checkError(tmpl.Execute(buf, this))
+	return blankLines.ReplaceAllString(buf.String(), "\n")
+}
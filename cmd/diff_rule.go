@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+	"gopkg.in/yaml.v2"
+)
+
+// 差分を無視する属性
+const (
+	ignoreAttributeComment       = "comment"
+	ignoreAttributeDefault       = "default"
+	ignoreAttributeColumnOrder   = "column_order"
+	ignoreAttributeAutoIncrement = "auto_increment"
+	ignoreAttributeCollation     = "collation"
+)
+
+var ignoreAttributes = []string{
+	ignoreAttributeComment,
+	ignoreAttributeDefault,
+	ignoreAttributeColumnOrder,
+	ignoreAttributeAutoIncrement,
+	ignoreAttributeCollation,
+}
+
+/**
+diff, checkの無視ルール(yaml)
+
+	attributes:          # 差分を無視する属性
+	  - comment
+	  - collation
+	tables:              # 無視するテーブル(glob)
+	  - "_*_gho"
+	  - "_*_ghc"
+	columns:             # 無視するカラム(table.column or column のglob)
+	  - "*.tmp_*"
+	indexes:             # 無視するインデックス(table.index or index のglob)
+	  - "user.tmp_idx"
+*/
+type diffRule struct {
+	Attributes []string `yaml:"attributes"`
+	Tables     []string `yaml:"tables"`
+	Columns    []string `yaml:"columns"`
+	Indexes    []string `yaml:"indexes"`
+}
+
+// pathが空の場合は空のルール
+func loadDiffRule(rulePath string) *diffRule {
+	res := &diffRule{}
+	if rulePath == "" {
+		return res
+	}
+	b, err := ioutil.ReadFile(rulePath)
+	checkError(err)
+	checkError(yaml.Unmarshal(b, res))
+	for _, attribute := range res.Attributes {
+		if !contains(ignoreAttributes, attribute) {
+			panic(fmt.Sprintf("unknown ignore attribute:%s in %s (%s)", attribute, rulePath, strings.Join(ignoreAttributes, ", ")))
+		}
+	}
+	for _, pattern := range append(append(append([]string{}, res.Tables...), res.Columns...), res.Indexes...) {
+		_, err := path.Match(pattern, "")
+		checkError(err)
+	}
+	return res
+}
+
+func (this *diffRule) AddAttribute(attribute string) {
+	if !this.IgnoresAttribute(attribute) {
+		this.Attributes = append(this.Attributes, attribute)
+	}
+}
+
+func (this *diffRule) IgnoresAttribute(attribute string) bool {
+	return contains(this.Attributes, attribute)
+}
+
+/**
+ルールを比較対象の定義に適用する
+無視するテーブル/カラム/インデックスは両方から除外し、
+無視する属性は新しい定義の値を比較元の値に揃える(比較元の値を維持する)
+*/
+func (this *diffRule) Apply(newModel, oldModel *models.Models) {
+	for _, m := range []*models.Models{newModel, oldModel} {
+		this.removeIgnoredObjects(m)
+	}
+
+	for _, newTable := range newModel.Tables {
+		oldTable := oldModel.GetTable(newTable.Name.LowerSnake())
+		if oldTable == nil {
+			continue
+		}
+		if this.IgnoresAttribute(ignoreAttributeComment) {
+			newTable.Comment = oldTable.Comment
+		}
+		if this.IgnoresAttribute(ignoreAttributeAutoIncrement) {
+			newTable.AutoIncrement = oldTable.AutoIncrement
+		}
+		if this.IgnoresAttribute(ignoreAttributeCollation) {
+			newTable.DefaultCharset = oldTable.DefaultCharset
+			newTable.DefaultCollation = oldTable.DefaultCollation
+		}
+		for _, newColumn := range newTable.Columns {
+			oldColumn := oldTable.GetColumn(newColumn.Name.LowerSnake())
+			if oldColumn == nil {
+				continue
+			}
+			if this.IgnoresAttribute(ignoreAttributeComment) {
+				newColumn.Comment = oldColumn.Comment
+			}
+			if this.IgnoresAttribute(ignoreAttributeDefault) {
+				newColumn.Default = oldColumn.Default
+			}
+			if this.IgnoresAttribute(ignoreAttributeCollation) && stripCollation(newColumn.Type) == stripCollation(oldColumn.Type) {
+				newColumn.Type = oldColumn.Type
+			}
+		}
+		if this.IgnoresAttribute(ignoreAttributeComment) {
+			for _, newIndex := range newTable.Indexes {
+				if oldIndex := oldTable.GetIndex(newIndex.Name); oldIndex != nil {
+					newIndex.Comment = oldIndex.Comment
+				}
+			}
+		}
+	}
+}
+
+func (this *diffRule) removeIgnoredObjects(m *models.Models) {
+	tables := make([]*models.Table, 0)
+	for _, t := range m.Tables {
+		tableName := t.Name.LowerSnake()
+		if matchAny(this.Tables, tableName) {
+			continue
+		}
+		tables = append(tables, t)
+
+		removeColumns := make([]*models.Column, 0)
+		for _, c := range t.Columns {
+			if matchObject(this.Columns, tableName, c.Name.LowerSnake()) {
+				removeColumns = append(removeColumns, c)
+			}
+		}
+		t.RemoveColumn(removeColumns...)
+
+		removeIndexes := make([]*models.Index, 0)
+		for _, in := range t.Indexes {
+			if matchObject(this.Indexes, tableName, in.Name) {
+				removeIndexes = append(removeIndexes, in)
+			}
+		}
+		t.RemoveIndex(removeIndexes...)
+	}
+	m.Tables = tables
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// "table.name" or "name"(全テーブル)
+func matchObject(patterns []string, tableName, name string) bool {
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, ".") {
+			pattern = "*." + pattern
+		}
+		if ok, _ := path.Match(pattern, tableName+"."+name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var collationPattern = regexp.MustCompile(`(?i)\s+(character set \w+|collate \w+|binary)`)
+
+// カラム型から文字セット/照合順序の指定を除く
+func stripCollation(columnType string) string {
+	return collationPattern.ReplaceAllString(columnType, "")
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+)
+
+// 分割出力する1つのマイグレーション
+type migrationFile struct {
+	// ファイル名の接尾辞
+	Name   string
+	Alter  *migration
+	Revert *migration
+}
+
+/**
+出力するマイグレーション
+	--phased: expand, contractの順
+	--split: それぞれをテーブル毎に分割
+*/
+func diffMigrationFiles(arg *DiffArg, newModel, oldModel *models.Models) []*migrationFile {
+	files := make([]*migrationFile, 0)
+	if arg.Phased {
+		phased := diffPhased(arg, newModel, oldModel)
+		files = append(files,
+			&migrationFile{Name: "expand", Alter: phased.ExpandAlter, Revert: phased.ExpandRevert},
+			&migrationFile{Name: "contract", Alter: phased.ContractAlter, Revert: phased.ContractRevert})
+	} else {
+		alter, revert := diffMigrations(arg, newModel, oldModel)
+		files = append(files, &migrationFile{Alter: alter, Revert: revert})
+	}
+	if !arg.Split {
+		return files
+	}
+
+	res := make([]*migrationFile, 0)
+	for _, file := range files {
+		res = append(res, splitMigration(file.Name, file.Alter, file.Revert, newModel, oldModel)...)
+	}
+	return res
+}
+
+/**
+差分をテーブル毎のマイグレーションに分割する
+循環参照の外部キーで結ばれたテーブルは1つにまとめる
+並びは外部キーの依存順(作成/変更は参照先が先、削除は参照元が先)
+*/
+func splitMigration(name string, alter, revert *migration, newModel, oldModel *models.Models) []*migrationFile {
+	_, dropTables, _ := diffTableByName(newModel, oldModel)
+	groups := models.SortTablesByDependency(newModel.Tables).Groups
+	dropGroups := models.SortTablesByDependency(dropTables).Groups
+	for i := len(dropGroups) - 1; 0 <= i; i-- {
+		groups = append(groups, dropGroups[i])
+	}
+
+	res := make([]*migrationFile, 0)
+	groupOf := make(map[string]*migrationFile)
+	for _, group := range groups {
+		names := make([]string, 0)
+		for _, t := range group {
+			names = append(names, t.Name.LowerSnake())
+		}
+		file := &migrationFile{
+			Name:   strings.Join(names, "-"),
+			Alter:  newMigration(),
+			Revert: newMigration(),
+		}
+		if name != "" {
+			file.Name = name + "_" + file.Name
+		}
+		for _, m := range []*migration{file.Alter, file.Revert} {
+			m.ExplainAlgorithm = alter.ExplainAlgorithm
+			m.AlgorithmClause = alter.AlgorithmClause
+		}
+		for _, n := range names {
+			groupOf[n] = file
+		}
+		res = append(res, file)
+	}
+
+	splitStatements(alter, groupOf, func(file *migrationFile) *migration { return file.Alter })
+	splitStatements(revert, groupOf, func(file *migrationFile) *migration { return file.Revert })
+
+	// 変更のないテーブルは出力しない
+	files := make([]*migrationFile, 0)
+	for _, file := range res {
+		if len(file.Alter.Statements) != 0 {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// テーブルに属さない文(コメント等)は次の文のテーブルに含める
+func splitStatements(m *migration, groupOf map[string]*migrationFile, target func(file *migrationFile) *migration) {
+	pending := make([]*migrationStatement, 0)
+	var last *migrationFile
+	for _, st := range m.Statements {
+		file, ok := groupOf[st.Table]
+		if !ok {
+			pending = append(pending, st)
+			continue
+		}
+		target(file).Statements = append(target(file).Statements, pending...)
+		target(file).Statements = append(target(file).Statements, st)
+		pending = pending[:0]
+		last = file
+	}
+	if last != nil {
+		target(last).Statements = append(target(last).Statements, pending...)
+	}
+}
+
+/**
+マイグレーションを出力する
+	-o ディレクトリ: 並び順に連番(1秒ずつずらした日付)のファイル
+	-o なし: 標準出力
+出力したマイグレーションがあればtrue
+*/
+func writeMigrationFiles(arg *DiffArg, files []*migrationFile) bool {
+	if arg.Format != "sql" && arg.Format != "goose" {
+		panic(fmt.Sprintf("--phased, --split do not support format:%s (sql, goose)", arg.Format))
+	}
+	if arg.Output != "" {
+		if info, err := os.Stat(arg.Output); err != nil || !info.IsDir() {
+			panic(fmt.Sprintf("--phased, --split require output directory:%s", arg.Output))
+		}
+	}
+
+	now := time.Now()
+	i := 0
+	written := false
+	for _, file := range files {
+		output := formatMigration(arg.Format, file.Alter.String(), file.Revert.String())
+		if output == "" {
+			continue
+		}
+		written = true
+		if arg.Output == "" {
+			fmt.Println("-- migration: " + file.Name)
+			fmt.Println(output)
+			continue
+		}
+		name := now.Add(time.Duration(i)*time.Second).Format("20060102150405") + "_" + arg.Format + "_" + file.Name + diffOutputExt(arg.Format)
+		out := filepath.Join(arg.Output, name)
+		fmt.Println(out)
+		checkError(ioutil.WriteFile(out, []byte(output), os.ModePerm))
+		i++
+	}
+	return written
+}
@@ -18,7 +18,11 @@ Usage:
 Arg:
     "conv"           テーブル定義ドキュメント or データベース間の変換
     "diff"           テーブル定義の差分出力(マイグレーション用)
+    "check"          テーブル定義の差分検査(差分があれば終了コード1)
+    "squash"         gooseマイグレーションをベースラインにまとめる
     "data"           データ定義の変換、mysql入出力
+    "data-diff"      データの差分出力(DMLのマイグレーション用)
+    "data-lint"      データをDB定義で検査(エラーがあれば終了コード1)
     "gen-single"     テーブル定義から1テキスト生成
     "gen-multiple"   テーブル定義から各テーブル毎にテキスト生成
     "exec"           sql実行(接続成功までリトライ)
@@ -42,13 +46,21 @@ func RunRoot() {
 
 	switch arguments["COMMAND"] {
 	default:
-		fmt.Println(usageRoot)
+		fmt.Print(usageRoot)
 	case "conv":
 		RunConv()
 	case "diff":
 		RunDiff()
+	case "check":
+		RunCheck()
+	case "squash":
+		RunSquash()
 	case "data":
 		RunData()
+	case "data-diff":
+		RunDataDiff()
+	case "data-lint":
+		RunDataLint()
 	case "gen-single":
 		RunGenSingle()
 	case "gen-multiple":
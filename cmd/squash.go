@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alfalfalfa/mysql_tool/models"
+	"github.com/alfalfalfa/mysql_tool/util/copy"
+	"github.com/docopt/docopt-go"
+)
+
+const usageSquash = `mysql_tool squash
+    gooseマイグレーションを1つのベースライン(CREATE TABLE)にまとめる
+
+Usage:
+    mysql_tool squash -h | --help
+    mysql_tool squash --until VERSION [--archive ARCHIVE] [--mysql-version VERSION] [--dry-run] DIR
+
+Arg:
+    マイグレーションのディレクトリ(diff -f goose -o DIR の出力先)
+
+Options:
+    -h --help                 Show this screen.
+    --until=VERSION           このバージョン以下のマイグレーションをまとめる
+        ベースラインのバージョンは、まとめた最後のマイグレーションのバージョン
+        (適用済みのデータベースではベースラインは実行されない)
+    --archive=ARCHIVE         まとめたマイグレーションの移動先(省略時はDIR/archive)
+    --mysql-version=VERSION   出力対象のMySQLバージョン(diffと同様)
+    --dry-run                 ベースラインを標準出力に出力し、ファイルの作成, 移動をしない
+
+Verification:
+    Up(-- +goose Up)のDDLを順に適用した定義からベースラインを作成し、
+    ベースライン + 以降のマイグレーションの適用結果が、全マイグレーションの適用結果と同一であることを検証する
+    本ツールが出力したDDLのみ対応(UPDATE等のデータ操作はベースラインに含まれないため警告)
+`
+
+type SquashArg struct {
+	Dir          string `arg:"DIR"`
+	Until        string `arg:"--until"`
+	Archive      string `arg:"--archive"`
+	MysqlVersion string `arg:"--mysql-version"`
+	DryRun       bool   `arg:"--dry-run"`
+}
+
+// マイグレーションファイル(<version>_xxx.sql)
+type migrationSource struct {
+	Path    string
+	Version int64
+}
+
+var migrationVersionPattern = regexp.MustCompile(`^(\d+)_.*\.sql$`)
+
+func RunSquash() {
+	arguments, err := docopt.Parse(usageSquash, os.Args[1:], true, "", false)
+	checkError(err)
+	arg := &SquashArg{}
+	copy.MapToStructWithTag(arguments, arg, "arg")
+	if arg.Archive == "" {
+		arg.Archive = filepath.Join(arg.Dir, "archive")
+	}
+	until, err := strconv.ParseInt(arg.Until, 10, 64)
+	checkError(err)
+	setTargetVersion(arg.MysqlVersion, &models.Models{})
+
+	sources := loadMigrationSources(arg.Dir)
+	squashes := make([]*migrationSource, 0)
+	remains := make([]*migrationSource, 0)
+	for _, src := range sources {
+		if src.Version <= until {
+			squashes = append(squashes, src)
+		} else {
+			remains = append(remains, src)
+		}
+	}
+	if len(squashes) == 0 {
+		panic(fmt.Sprintf("no migration to squash until:%d in %s", until, arg.Dir))
+	}
+	version := squashes[len(squashes)-1].Version
+
+	// まとめる範囲と全マイグレーションの適用結果
+	replay := &models.Models{}
+	replayMigrations(replay, squashes, true)
+	squashed := models.NewModels(models.CloneTables(replay.Tables))
+	replayMigrations(replay, remains, false)
+	full := models.NewModels(replay.Tables)
+
+	baseline := toBaselineSQL(squashed)
+	verifySquash(baseline, squashed, full, remains)
+
+	name := fmt.Sprintf("%d_goose_baseline.sql", version)
+	if arg.DryRun {
+		fmt.Println("-- " + name)
+		fmt.Println(baseline)
+		return
+	}
+
+	checkError(os.MkdirAll(arg.Archive, os.ModePerm))
+	for _, src := range squashes {
+		checkError(os.Rename(src.Path, filepath.Join(arg.Archive, filepath.Base(src.Path))))
+	}
+	out := filepath.Join(arg.Dir, name)
+	checkError(ioutil.WriteFile(out, []byte(baseline), os.ModePerm))
+	fmt.Println(out)
+	fmt.Printf("archived %d migrations to %s\n", len(squashes), arg.Archive)
+}
+
+// バージョン順
+func loadMigrationSources(dir string) []*migrationSource {
+	files, err := ioutil.ReadDir(dir)
+	checkError(err)
+	res := make([]*migrationSource, 0)
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		m := migrationVersionPattern.FindStringSubmatch(f.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		checkError(err)
+		res = append(res, &migrationSource{
+			Path:    filepath.Join(dir, f.Name()),
+			Version: version,
+		})
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res
+}
+
+// warnがtrueの場合、ベースラインに含まれないデータ操作を警告する
+func replayMigrations(m *models.Models, sources []*migrationSource, warn bool) {
+	for _, src := range sources {
+		b, err := ioutil.ReadFile(src.Path)
+		checkError(err)
+		dataStatements := applyMigrationSQL(m, src.Path, gooseUpSection(string(b)))
+		if warn && len(dataStatements) != 0 {
+			fmt.Fprintf(os.Stderr, "warning: %d data statements are not included in the baseline: %s\n", len(dataStatements), src.Path)
+		}
+	}
+}
+
+// エラー時にファイル名を付与する
+func applyMigrationSQL(m *models.Models, label string, sql string) []string {
+	defer func() {
+		if err := recover(); err != nil {
+			panic(fmt.Sprintf("%s: %v", label, err))
+		}
+	}()
+	return m.ApplySQL(sql)
+}
+
+// -- +goose Up から -- +goose Down まで(gooseの注釈がなければ全体)
+func gooseUpSection(sql string) string {
+	lines := strings.Split(sql, "\n")
+	res := make([]string, 0)
+	up := false
+	found := false
+	for _, line := range lines {
+		switch strings.TrimSpace(line) {
+		case "-- +goose Up":
+			up = true
+			found = true
+			continue
+		case "-- +goose Down":
+			up = false
+			continue
+		}
+		if up {
+			res = append(res, line)
+		}
+	}
+	if !found {
+		return sql
+	}
+	return strings.Join(res, "\n")
+}
+
+// 外部キーの依存順のCREATE TABLE, 逆順のDROP TABLE
+func toBaselineSQL(m *models.Models) string {
+	arg := &DiffArg{ForeignKey: true}
+	order := models.SortTablesByDependency(m.Tables)
+	alter := newMigration()
+	revert := newMigration()
+	writeCreateTables(alter, order, arg)
+	writeDropTables(revert, order, arg)
+	return formatMigration("goose", alter.String(), revert.String())
+}
+
+/**
+ベースラインの適用結果がまとめた範囲の適用結果と、
+ベースライン + 以降のマイグレーションの適用結果が全マイグレーションの適用結果と同一であること
+*/
+func verifySquash(baseline string, squashed, full *models.Models, remains []*migrationSource) {
+	arg := &DiffArg{ForeignKey: true}
+
+	replay := &models.Models{}
+	applyMigrationSQL(replay, "baseline", gooseUpSection(baseline))
+	if alter, _ := diffDefines(arg, models.NewModels(models.CloneTables(replay.Tables)), squashed); alter != "" {
+		panic("squash verification failed. baseline differs from the squashed migrations:\n" + alter)
+	}
+	replayMigrations(replay, remains, false)
+	if alter, _ := diffDefines(arg, models.NewModels(replay.Tables), full); alter != "" {
+		panic("squash verification failed. baseline and the remaining migrations differ from the full replay:\n" + alter)
+	}
+}
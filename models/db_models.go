@@ -14,6 +14,21 @@ type MysqlTable struct {
 	Engine    string `gorm:"column:Engine"`
 	Collation string `gorm:"column:Collation"`
 	Comment   string `gorm:"column:Comment"`
+
+	// 統計情報(InnoDBでは概算値)
+	Rows        sql.NullInt64 `gorm:"column:Rows"`
+	DataLength  sql.NullInt64 `gorm:"column:Data_length"`
+	IndexLength sql.NullInt64 `gorm:"column:Index_length"`
+
+	AutoIncrement sql.NullInt64 `gorm:"column:Auto_increment"`
+}
+
+func (this MysqlTable) GetStats() *TableStats {
+	return &TableStats{
+		Rows:        this.Rows.Int64,
+		DataLength:  this.DataLength.Int64,
+		IndexLength: this.IndexLength.Int64,
+	}
 }
 
 func (this MysqlTable) GetName() string {
@@ -30,6 +45,12 @@ func (this MysqlTable) IsBinaryCollation() bool {
 	return tmp[len(tmp)-1] == "bin"
 }
 
+func LoadMysqlVersion(db *gorm.DB) string {
+	var version string
+	checkError(db.Raw("SELECT VERSION()").Scan(&version).Error)
+	return version
+}
+
 func LoadMysqlTables(db *gorm.DB) []MysqlTable {
 	var fields []MysqlTable
 	db.Raw("SHOW TABLE STATUS").Find(&fields)
@@ -83,12 +104,18 @@ type MysqlIndex struct {
 	Cardinality sql.NullInt64 `gorm:"column:Cardinality"`
 	Type        string        `gorm:"column:Index_type"`
 	Comment     string        `gorm:"column:Index_comment"`
+	Visible     null.String   `gorm:"column:Visible"`
 }
 
 func (this MysqlIndex) GetName() string {
 	return strings.ToLower(this.KeyName)
 }
 
+// 8.0以降のみVisibleカラムが存在する
+func (this MysqlIndex) IsInvisible() bool {
+	return this.Visible.ValueOrZero() == "NO"
+}
+
 func LoadMysqlIndexes(db *gorm.DB, table string) []MysqlIndex {
 	var fields []MysqlIndex
 	db.Raw("SHOW INDEX FROM `" + table + "`").Find(&fields)
@@ -0,0 +1,216 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// 外部キーの依存関係によるテーブルの作成順
+type TableOrder struct {
+	// 作成順(参照先テーブルが先)。削除時は逆順
+	Tables []*Table
+	// 循環参照/自己参照のため、全テーブル作成後にALTERで追加する外部キー
+	Deferred []*Reference
+	// 循環参照しているテーブルの組
+	Cycles [][]*Table
+	// 循環参照しているテーブルを1つにまとめた組の作成順
+	Groups [][]*Table
+}
+
+func (this TableOrder) IsDeferred(c *Column) bool {
+	for _, ref := range this.Deferred {
+		if ref.From.Column == c {
+			return true
+		}
+	}
+	return false
+}
+
+// 作成時に同時に付与できる外部キーのカラム
+func (this TableOrder) GetImmediateRefColumns(t *Table) []*Column {
+	res := make([]*Column, 0)
+	for _, c := range t.Columns {
+		if c.Reference == "" || this.IsDeferred(c) {
+			continue
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+func (this TableOrder) GetCycleNames() []string {
+	res := make([]string, 0)
+	for _, cycle := range this.Cycles {
+		names := make([]string, 0)
+		for _, t := range cycle {
+			names = append(names, "`"+t.Name.LowerSnake()+"`")
+		}
+		res = append(res, strings.Join(names, ", "))
+	}
+	return res
+}
+
+/**
+Table.Referencesから依存グラフを作り、トポロジカル順に並べる。
+対象外のテーブルへの参照は順序に影響しない。
+同順位のテーブルは引数の順序を保つ。
+*/
+func SortTablesByDependency(tables []*Table) *TableOrder {
+	res := &TableOrder{
+		Tables:   make([]*Table, 0),
+		Deferred: make([]*Reference, 0),
+		Cycles:   make([][]*Table, 0),
+		Groups:   make([][]*Table, 0),
+	}
+
+	position := make(map[*Table]int)
+	for i, t := range tables {
+		position[t] = i
+	}
+
+	// 依存先(参照先テーブル)
+	depends := make(map[*Table][]*Table)
+	for _, t := range tables {
+		depends[t] = make([]*Table, 0)
+		for _, ref := range t.References {
+			to := ref.To.Table
+			if to == t {
+				continue
+			}
+			if _, ok := position[to]; !ok {
+				continue
+			}
+			depends[t] = append(depends[t], to)
+		}
+	}
+
+	// 循環参照の検出(強連結成分)
+	component := make(map[*Table]int)
+	for i, scc := range stronglyConnectedComponents(tables, depends) {
+		for _, t := range scc {
+			component[t] = i
+		}
+		if len(scc) < 2 {
+			continue
+		}
+		sort.Slice(scc, func(i, j int) bool { return position[scc[i]] < position[scc[j]] })
+		res.Cycles = append(res.Cycles, scc)
+	}
+	// 自己参照と循環内の参照は後から追加する
+	for _, t := range tables {
+		for _, ref := range t.References {
+			to := ref.To.Table
+			if _, ok := position[to]; !ok {
+				continue
+			}
+			if to == t || component[to] == component[t] {
+				res.Deferred = append(res.Deferred, ref)
+			}
+		}
+	}
+
+	// トポロジカルソート(循環内の参照は除外)
+	done := make(map[*Table]bool)
+	for len(res.Tables) < len(tables) {
+		for _, t := range tables {
+			if done[t] {
+				continue
+			}
+			ready := true
+			for _, to := range depends[t] {
+				if !done[to] && component[to] != component[t] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[t] = true
+				res.Tables = append(res.Tables, t)
+				break
+			}
+		}
+	}
+
+	// 組のトポロジカルソート(組内の並びは作成順)
+	members := make(map[int][]*Table)
+	components := make([]int, 0)
+	for _, t := range res.Tables {
+		if _, ok := members[component[t]]; !ok {
+			components = append(components, component[t])
+		}
+		members[component[t]] = append(members[component[t]], t)
+	}
+	doneGroup := make(map[int]bool)
+	for len(res.Groups) < len(components) {
+		for _, c := range components {
+			if doneGroup[c] {
+				continue
+			}
+			ready := true
+			for _, t := range members[c] {
+				for _, to := range depends[t] {
+					if component[to] != c && !doneGroup[component[to]] {
+						ready = false
+					}
+				}
+			}
+			if ready {
+				doneGroup[c] = true
+				res.Groups = append(res.Groups, members[c])
+				break
+			}
+		}
+	}
+	return res
+}
+
+// Tarjanのアルゴリズム
+func stronglyConnectedComponents(tables []*Table, depends map[*Table][]*Table) [][]*Table {
+	res := make([][]*Table, 0)
+	index := make(map[*Table]int)
+	lowLink := make(map[*Table]int)
+	onStack := make(map[*Table]bool)
+	stack := make([]*Table, 0)
+	counter := 0
+
+	var visit func(t *Table)
+	visit = func(t *Table) {
+		index[t] = counter
+		lowLink[t] = counter
+		counter++
+		stack = append(stack, t)
+		onStack[t] = true
+
+		for _, to := range depends[t] {
+			if _, ok := index[to]; !ok {
+				visit(to)
+				if lowLink[to] < lowLink[t] {
+					lowLink[t] = lowLink[to]
+				}
+			} else if onStack[to] && index[to] < lowLink[t] {
+				lowLink[t] = index[to]
+			}
+		}
+
+		if lowLink[t] == index[t] {
+			scc := make([]*Table, 0)
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				scc = append(scc, top)
+				if top == t {
+					break
+				}
+			}
+			res = append(res, scc)
+		}
+	}
+
+	for _, t := range tables {
+		if _, ok := index[t]; !ok {
+			visit(t)
+		}
+	}
+	return res
+}
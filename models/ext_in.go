@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -9,7 +10,7 @@ import (
 )
 
 func LoadModel(ignoreTables []string, inputs ...string) *Models {
-	if isDsnString(inputs[0]) {
+	if IsDsnString(inputs[0]) {
 		if 1 < len(inputs) {
 			panic("multiple dsn")
 		}
@@ -17,7 +18,7 @@ func LoadModel(ignoreTables []string, inputs ...string) *Models {
 	}
 
 	tables := make([]*Table, 0)
-	for _, path := range resolvFilePathes(inputs...) {
+	for _, path := range ResolvFilePathes(inputs...) {
 		switch DetectInputFormat(path) {
 		case "xlsx":
 			tables = append(tables, loadTablesFromExcel(ignoreTables, path)...)
@@ -36,6 +37,47 @@ func LoadModel(ignoreTables []string, inputs ...string) *Models {
 	return res
 }
 
+// ファイルのテーブル定義(参照は未解決)
+func LoadTablesFromFile(path string) []*Table {
+	switch DetectInputFormat(path) {
+	case "xlsx":
+		return loadTablesFromExcel(nil, path)
+	case "json":
+		return loadTablesFromJson(nil, path)
+	case "yaml":
+		return loadTablesFromYaml(nil, path)
+	}
+	panic(fmt.Sprint("input path must be [.json, .yaml, .yml, .xlsx] path:", path))
+}
+
+/**
+テーブル定義を複製する(参照は未解決)
+NewModelsで参照を解決する
+*/
+func CloneTables(tables []*Table) []*Table {
+	res := make([]*Table, 0)
+	b, err := json.Marshal(tables)
+	checkError(err)
+	checkError(json.Unmarshal(b, &res))
+	return res
+}
+
+func CloneColumn(c *Column) *Column {
+	res := &Column{}
+	b, err := json.Marshal(c)
+	checkError(err)
+	checkError(json.Unmarshal(b, res))
+	return res
+}
+
+// 参照を解決したModels
+func NewModels(tables []*Table) *Models {
+	res := &Models{}
+	res.Tables = tables
+	res.resolveReferences()
+	return res
+}
+
 func DetectInputFormat(input string) string {
 	if filepath.Ext(input) == ".xlsx" {
 		return "xlsx"
@@ -49,10 +91,16 @@ func DetectInputFormat(input string) string {
 	if filepath.Ext(input) == ".yml" {
 		return "yaml"
 	}
+	if filepath.Ext(input) == ".csv" {
+		return "csv"
+	}
+	if filepath.Ext(input) == ".tsv" {
+		return "tsv"
+	}
 	return "mysql"
 }
 
-func isDsnString(input string) bool {
+func IsDsnString(input string) bool {
 	// コロンが含まれていて存在しないパスであればmysql接続文字列とする
 	if !strings.Contains(input, ":") {
 		return false
@@ -61,7 +109,7 @@ func isDsnString(input string) bool {
 	return err != nil
 }
 
-func resolvFilePathes(pathes ...string) []string {
+func ResolvFilePathes(pathes ...string) []string {
 	res := make([]string, 0)
 	for _, path := range pathes {
 		fileInfo, err := os.Stat(path)
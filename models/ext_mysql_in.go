@@ -13,6 +13,7 @@ func NewModelFromMysql(ignoreTables []string, fqdn string) *Models {
 	res.Tables = make([]*Table, 0)
 	db, err := gorm.Open(mysql.Open(fqdn))
 	checkError(err)
+	res.MysqlVersion = LoadMysqlVersion(db)
 
 	for _, tableInfo := range LoadMysqlTables(db) {
 		// 無視するテーブル名を確認
@@ -59,6 +60,8 @@ func NewTableFromMysql(db *gorm.DB, tableInfo MysqlTable) *Table {
 	t.DefaultCollation = tableInfo.Collation
 
 	t.Comment = tableInfo.Comment
+	t.Stats = tableInfo.GetStats()
+	t.AutoIncrement = tableInfo.AutoIncrement.Int64
 	//t.MetaDataJson = strings.TrimSpace(row.Cells[8].Value)
 
 	t.Columns = make([]*Column, 0)
@@ -71,6 +74,9 @@ func NewTableFromMysql(db *gorm.DB, tableInfo MysqlTable) *Table {
 			c.PrimaryKey = pkIndex
 			c.Extra = columnInfo.Extra
 		}
+		if strings.Contains(strings.ToUpper(columnInfo.Extra), "INVISIBLE") && !c.IsInvisible() {
+			c.Extra = strings.TrimSpace(c.Extra + " INVISIBLE")
+		}
 
 		t.Columns = append(t.Columns, c)
 	}
@@ -143,6 +149,9 @@ func NewIndexFromMysql(db *gorm.DB, indexInfos []MysqlIndex) *Index {
 			in.Type = indexInfo.Type
 		}
 		in.Comment = indexInfo.Comment
+		if indexInfo.IsInvisible() {
+			in.Options = "INVISIBLE"
+		}
 		in.ColumnNames[indexInfo.SeqInIndex-1] = strings.ToLower(indexInfo.ColumnName)
 	}
 
@@ -0,0 +1,646 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alfalfalfa/mysql_tool/util"
+	"github.com/alfalfalfa/mysql_tool/util/null"
+)
+
+/**
+本ツールが出力したDDL(diff, convのsql)を定義に適用する
+	CREATE TABLE, DROP TABLE
+	ALTER TABLE (ADD/DROP/MODIFY/CHANGE/RENAME COLUMN, ADD/DROP/RENAME/ALTER INDEX, ADD CONSTRAINT/DROP FOREIGN KEY, テーブルオプション)
+BEGIN, SET等は無視し、データ操作(UPDATE, INSERT等)や定義を変更しない文(ANALYZE, CALL, SELECT等)は適用せずに返す
+それ以外の文はpanic
+
+適用後はNewModelsで参照を解決する
+*/
+func (this *Models) ApplySQL(sql string) (dataStatements []string) {
+	dataStatements = make([]string, 0)
+	for _, statement := range splitSQLStatements(sql) {
+		tokens := tokenizeSQL(statement)
+		if len(tokens) == 0 {
+			continue
+		}
+		switch strings.ToUpper(tokens[0]) {
+		case "BEGIN", "COMMIT", "ROLLBACK", "SET", "START":
+		case "UPDATE", "INSERT", "DELETE", "REPLACE", "TRUNCATE", "LOAD",
+			"SELECT", "CALL", "DO", "ANALYZE", "OPTIMIZE", "CHECK", "CHECKSUM", "REPAIR", "FLUSH":
+			dataStatements = append(dataStatements, statement)
+		case "CREATE":
+			this.applyCreateTable(statement, tokens)
+		case "DROP":
+			this.applyDropTable(statement, tokens)
+		case "ALTER":
+			this.applyAlterTable(statement)
+		default:
+			panic(fmt.Sprintf("unsupported statement: %s", statement))
+		}
+	}
+	return
+}
+
+func (this *Models) applyCreateTable(statement string, tokens []string) {
+	i := 1
+	if !isKeyword(tokens, i, "TABLE") {
+		panic(fmt.Sprintf("unsupported statement: %s", statement))
+	}
+	i++
+	if isKeyword(tokens, i, "IF") {
+		i += 3
+	}
+	if len(tokens) <= i+1 || !strings.HasPrefix(tokens[i+1], "(") {
+		panic(fmt.Sprintf("invalid create table: %s", statement))
+	}
+	name := unquoteIdentifier(tokens[i])
+	// IF NOT EXISTSで既に存在する場合は何もしない
+	if this.GetTable(name) != nil {
+		return
+	}
+
+	t := &Table{
+		Name:    util.NewCaseString(name),
+		Columns: make([]*Column, 0),
+		Indexes: make([]*Index, 0),
+	}
+	for _, def := range splitSQLTopLevel(strings.TrimSuffix(strings.TrimPrefix(tokens[i+1], "("), ")")) {
+		defTokens := tokenizeSQL(def)
+		if len(defTokens) == 0 {
+			continue
+		}
+		switch {
+		case isKeyword(defTokens, 0, "PRIMARY"):
+			for pk, columnName := range parseSQLColumnNames(defTokens[len(defTokens)-1]) {
+				t.mustGetColumn(columnName).PrimaryKey = pk + 1
+			}
+		case isKeyword(defTokens, 0, "CONSTRAINT"):
+			t.applyForeignKey(defTokens[1:])
+		case isIndexDefinition(defTokens):
+			t.Indexes = append(t.Indexes, parseSQLIndex(defTokens))
+		default:
+			c, _ := parseSQLColumn(defTokens)
+			t.Columns = append(t.Columns, c)
+		}
+	}
+	t.applyTableOptions(tokens[i+2:])
+	this.Tables = append(this.Tables, t)
+}
+
+func (this *Models) applyDropTable(statement string, tokens []string) {
+	if !isKeyword(tokens, 1, "TABLE") {
+		panic(fmt.Sprintf("unsupported statement: %s", statement))
+	}
+	for _, token := range tokens[2:] {
+		if isKeyword([]string{token}, 0, "IF") || isKeyword([]string{token}, 0, "EXISTS") || token == "," {
+			continue
+		}
+		name := unquoteIdentifier(token)
+		tables := make([]*Table, 0)
+		for _, t := range this.Tables {
+			if t.Name.LowerSnake() != strings.ToLower(name) {
+				tables = append(tables, t)
+			}
+		}
+		this.Tables = tables
+	}
+}
+
+func (this *Models) applyAlterTable(statement string) {
+	tokens := tokenizeSQL(statement)
+	if !isKeyword(tokens, 1, "TABLE") || len(tokens) < 3 {
+		panic(fmt.Sprintf("unsupported statement: %s", statement))
+	}
+	t := this.GetTable(unquoteIdentifier(tokens[2]))
+	if t == nil {
+		panic(fmt.Sprintf("table not found: %s", statement))
+	}
+
+	// ALTER TABLE `name` 以降の変更をカンマで分割
+	rest := statement[strings.Index(statement, tokens[2])+len(tokens[2]):]
+	for _, spec := range splitSQLTopLevel(rest) {
+		specTokens := tokenizeSQL(spec)
+		if len(specTokens) == 0 {
+			continue
+		}
+		keyword := strings.ToUpper(specTokens[0])
+		switch {
+		case keyword == "ADD" && isKeyword(specTokens, 1, "COLUMN"):
+			c, order := parseSQLColumn(specTokens[2:])
+			t.insertColumn(c, order)
+		case keyword == "ADD" && isKeyword(specTokens, 1, "CONSTRAINT"):
+			t.applyForeignKey(specTokens[2:])
+		case keyword == "ADD" && isKeyword(specTokens, 1, "PRIMARY"):
+			for pk, columnName := range parseSQLColumnNames(specTokens[len(specTokens)-1]) {
+				t.mustGetColumn(columnName).PrimaryKey = pk + 1
+			}
+		case keyword == "ADD" && isIndexDefinition(specTokens[1:]):
+			t.Indexes = append(t.Indexes, parseSQLIndex(specTokens[1:]))
+		case keyword == "DROP" && isKeyword(specTokens, 1, "COLUMN"):
+			this.dropColumn(t, unquoteIdentifier(specTokens[2]))
+		case keyword == "DROP" && (isKeyword(specTokens, 1, "INDEX") || isKeyword(specTokens, 1, "KEY")):
+			in := t.GetIndex(unquoteIdentifier(specTokens[2]))
+			if in == nil {
+				panic(fmt.Sprintf("index not found: %s", statement))
+			}
+			t.RemoveIndex(in)
+		case keyword == "DROP" && isKeyword(specTokens, 1, "FOREIGN"):
+			t.dropForeignKey(unquoteIdentifier(specTokens[3]))
+		case keyword == "DROP" && isKeyword(specTokens, 1, "PRIMARY"):
+			for _, c := range t.Columns {
+				c.PrimaryKey = 0
+			}
+		case keyword == "MODIFY":
+			c, order := parseSQLColumn(specTokens[2:])
+			old := t.mustGetColumn(c.Name.LowerSnake())
+			c.PrimaryKey = old.PrimaryKey
+			c.Reference = old.Reference
+			t.replaceColumn(old, c, order)
+		case keyword == "CHANGE":
+			i := 1
+			if isKeyword(specTokens, i, "COLUMN") {
+				i++
+			}
+			old := t.mustGetColumn(unquoteIdentifier(specTokens[i]))
+			c, order := parseSQLColumn(specTokens[i+1:])
+			c.PrimaryKey = old.PrimaryKey
+			c.Reference = old.Reference
+			this.renameColumn(t, old.Name.LowerSnake(), c.Name.LowerSnake())
+			t.replaceColumn(old, c, order)
+		case keyword == "RENAME" && isKeyword(specTokens, 1, "COLUMN"):
+			from := unquoteIdentifier(specTokens[2])
+			to := unquoteIdentifier(specTokens[4])
+			t.mustGetColumn(from).Name = util.NewCaseString(to)
+			this.renameColumn(t, from, to)
+		case keyword == "RENAME" && (isKeyword(specTokens, 1, "INDEX") || isKeyword(specTokens, 1, "KEY")):
+			in := t.GetIndex(unquoteIdentifier(specTokens[2]))
+			if in == nil {
+				panic(fmt.Sprintf("index not found: %s", statement))
+			}
+			in.Name = unquoteIdentifier(specTokens[4])
+		case keyword == "ALTER" && isKeyword(specTokens, 1, "INDEX"):
+			in := t.GetIndex(unquoteIdentifier(specTokens[2]))
+			if in == nil {
+				panic(fmt.Sprintf("index not found: %s", statement))
+			}
+			options := strings.TrimSpace(strings.Replace(strings.Replace(strings.ToUpper(in.Options), "INVISIBLE", "", -1), "VISIBLE", "", -1))
+			if isKeyword(specTokens, 3, "INVISIBLE") {
+				options = strings.TrimSpace(options + " INVISIBLE")
+			}
+			in.Options = options
+		case keyword == "ALGORITHM" || keyword == "LOCK":
+		case keyword == "ENGINE" || keyword == "DEFAULT" || keyword == "COMMENT" || keyword == "CHARSET" || keyword == "CHARACTER" || keyword == "COLLATE" || keyword == "AUTO_INCREMENT":
+			t.applyTableOptions(specTokens)
+		default:
+			panic(fmt.Sprintf("unsupported alter table: %s", statement))
+		}
+	}
+}
+
+// ENGINE = InnoDB DEFAULT CHARACTER SET = utf8mb4 COMMENT = '...'
+func (this *Table) applyTableOptions(tokens []string) {
+	values := make(map[string]string)
+	key := ""
+	for _, token := range tokens {
+		if token == "=" {
+			continue
+		}
+		switch word := strings.ToUpper(token); word {
+		case "ENGINE", "CHARSET", "COLLATE", "COMMENT", "AUTO_INCREMENT":
+			key = word
+		case "SET":
+			// CHARACTER SET
+			key = "CHARSET"
+		case "DEFAULT", "CHARACTER":
+		default:
+			if key == "" {
+				panic(fmt.Sprintf("unsupported table option: %s", strings.Join(tokens, " ")))
+			}
+			values[key] = unquoteSQLString(token)
+		}
+	}
+	if v, ok := values["ENGINE"]; ok {
+		this.Engine = v
+	}
+	if v, ok := values["CHARSET"]; ok {
+		this.DefaultCharset = v
+	}
+	if v, ok := values["COLLATE"]; ok {
+		this.DefaultCollation = v
+	}
+	if v, ok := values["COMMENT"]; ok {
+		this.Comment = v
+	}
+	if v, ok := values["AUTO_INCREMENT"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		checkError(err)
+		this.AutoIncrement = n
+	}
+}
+
+// `symbol` FOREIGN KEY (`column`) REFERENCES `table` (`column`)
+func (this *Table) applyForeignKey(tokens []string) {
+	if len(tokens) < 6 || !isKeyword(tokens, 1, "FOREIGN") || !isKeyword(tokens, 4, "REFERENCES") {
+		panic(fmt.Sprintf("unsupported foreign key: %s", strings.Join(tokens, " ")))
+	}
+	columns := parseSQLColumnNames(tokens[3])
+	refColumns := parseSQLColumnNames(tokens[6])
+	if len(columns) != 1 || len(refColumns) != 1 {
+		panic(fmt.Sprintf("unsupported composite foreign key: %s", strings.Join(tokens, " ")))
+	}
+	this.mustGetColumn(columns[0]).Reference = unquoteIdentifier(tokens[5]) + "." + refColumns[0]
+}
+
+// 外部キー名はToFKAddSQLの命名規則から対象カラムを特定する
+func (this *Table) dropForeignKey(symbol string) {
+	for _, c := range this.Columns {
+		if c.Reference == "" {
+			continue
+		}
+		ref := strings.Split(c.Reference, ".")
+		if "ref_"+generateConstraintSymbol(this.Name.LowerSnake(), c.Name.LowerSnake(), ref[0], ref[1]) == symbol {
+			c.Reference = ""
+			return
+		}
+	}
+	panic(fmt.Sprintf("foreign key not found. table:%s, foreign key:%s", this.Name.LowerSnake(), symbol))
+}
+
+func (this *Table) mustGetColumn(name string) *Column {
+	c := this.GetColumn(name)
+	if c == nil {
+		panic(fmt.Sprintf("column not found. table:%s, column:%s", this.Name.LowerSnake(), name))
+	}
+	return c
+}
+
+// order: "FIRST", "AFTER xxx", 空は末尾
+func (this *Table) insertColumn(c *Column, order string) {
+	i := len(this.Columns)
+	if order == "FIRST" {
+		i = 0
+	} else if strings.HasPrefix(order, "AFTER ") {
+		i = this.columnIndex(this.mustGetColumn(strings.TrimPrefix(order, "AFTER "))) + 1
+	}
+	this.Columns = append(this.Columns[:i], append([]*Column{c}, this.Columns[i:]...)...)
+}
+
+// orderが空の場合は同じ位置
+func (this *Table) replaceColumn(old, c *Column, order string) {
+	i := this.columnIndex(old)
+	if order == "" {
+		this.Columns[i] = c
+		return
+	}
+	this.Columns = append(this.Columns[:i], this.Columns[i+1:]...)
+	this.insertColumn(c, order)
+}
+
+func (this *Table) columnIndex(c *Column) int {
+	for i, v := range this.Columns {
+		if v == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// MySQLと同様にインデックスからカラムを除き、空になったインデックスは削除する
+func (this *Models) dropColumn(t *Table, name string) {
+	c := t.mustGetColumn(name)
+	t.Columns = append(t.Columns[:t.columnIndex(c)], t.Columns[t.columnIndex(c)+1:]...)
+	if c.PrimaryKey != 0 {
+		pk := 1
+		for _, pkColumn := range t.getPrimaryKeys() {
+			if pkColumn != c {
+				pkColumn.PrimaryKey = pk
+				pk++
+			}
+		}
+		c.PrimaryKey = 0
+	}
+	indexes := make([]*Index, 0)
+	for _, in := range t.Indexes {
+		columnNames := make([]string, 0)
+		for _, columnName := range in.ColumnNames {
+			if columnName != c.Name.LowerSnake() {
+				columnNames = append(columnNames, columnName)
+			}
+		}
+		in.ColumnNames = columnNames
+		if len(columnNames) != 0 {
+			indexes = append(indexes, in)
+		}
+	}
+	t.Indexes = indexes
+}
+
+// インデックスと、参照元の外部キーのカラム名を変更する
+func (this *Models) renameColumn(t *Table, from, to string) {
+	if from == to {
+		return
+	}
+	for _, in := range t.Indexes {
+		for i, columnName := range in.ColumnNames {
+			if columnName == from {
+				in.ColumnNames[i] = to
+			}
+		}
+	}
+	for _, other := range this.Tables {
+		for _, c := range other.Columns {
+			if c.Reference == t.Name.LowerSnake()+"."+from {
+				c.Reference = t.Name.LowerSnake() + "." + to
+			}
+		}
+	}
+}
+
+func isIndexDefinition(tokens []string) bool {
+	for _, token := range tokens {
+		switch strings.ToUpper(token) {
+		case "UNIQUE", "FULLTEXT", "SPATIAL":
+			continue
+		case "INDEX", "KEY":
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// [UNIQUE|FULLTEXT|SPATIAL] INDEX `name` (`column`, ...) [options] [COMMENT '...']
+func parseSQLIndex(tokens []string) *Index {
+	in := &Index{}
+	i := 0
+	for ; i < len(tokens); i++ {
+		word := strings.ToUpper(tokens[i])
+		if word == "UNIQUE" {
+			in.Unique = true
+		} else if word == "FULLTEXT" || word == "SPATIAL" {
+			in.Type = word
+		} else if word == "INDEX" || word == "KEY" {
+			i++
+			break
+		}
+	}
+	if len(tokens) <= i+1 {
+		panic(fmt.Sprintf("invalid index: %s", strings.Join(tokens, " ")))
+	}
+	in.Name = unquoteIdentifier(tokens[i])
+	in.ColumnNames = parseSQLColumnNames(tokens[i+1])
+	options := make([]string, 0)
+	for i += 2; i < len(tokens); i++ {
+		if isKeyword(tokens, i, "COMMENT") && i+1 < len(tokens) {
+			in.Comment = unquoteSQLString(tokens[i+1])
+			i++
+			continue
+		}
+		options = append(options, tokens[i])
+	}
+	in.Options = strings.Join(options, " ")
+	return in
+}
+
+// カラム型の後に続く属性
+var sqlColumnAttributes = []string{"NOT", "NULL", "DEFAULT", "COMMENT", "AUTO_INCREMENT", "ON", "INVISIBLE", "VISIBLE", "FIRST", "AFTER", "PRIMARY", "UNIQUE", "GENERATED", "AS", "DEFAULT_GENERATED"}
+
+// `name` type [NOT NULL] [DEFAULT x] [extra] [COMMENT '...'] [FIRST|AFTER x]
+func parseSQLColumn(tokens []string) (c *Column, order string) {
+	if len(tokens) < 2 {
+		panic(fmt.Sprintf("invalid column: %s", strings.Join(tokens, " ")))
+	}
+	c = &Column{Name: util.NewCaseString(unquoteIdentifier(tokens[0]))}
+	i := 1
+	types := make([]string, 0)
+	for ; i < len(tokens) && !contains(sqlColumnAttributes, strings.ToUpper(tokens[i])); i++ {
+		types = append(types, tokens[i])
+	}
+	c.Type = strings.Join(types, " ")
+
+	extras := make([]string, 0)
+	for ; i < len(tokens); i++ {
+		switch strings.ToUpper(tokens[i]) {
+		case "NOT":
+			if isKeyword(tokens, i+1, "NULL") {
+				c.NotNull = true
+				i++
+				continue
+			}
+		case "NULL":
+			continue
+		case "DEFAULT":
+			if i+1 < len(tokens) {
+				if !isKeyword(tokens, i+1, "NULL") {
+					c.Default = null.StringFrom(unquoteSQLString(tokens[i+1]))
+				}
+				i++
+				continue
+			}
+		case "COMMENT":
+			if i+1 < len(tokens) {
+				c.Comment = unquoteSQLString(tokens[i+1])
+				i++
+				continue
+			}
+		case "FIRST":
+			order = "FIRST"
+			continue
+		case "AFTER":
+			if i+1 < len(tokens) {
+				order = "AFTER " + unquoteIdentifier(tokens[i+1])
+				i++
+				continue
+			}
+		}
+		extras = append(extras, tokens[i])
+	}
+	c.Extra = strings.Join(extras, " ")
+	return
+}
+
+// (`a`, `b`(10) DESC) -> [a, b]
+func parseSQLColumnNames(group string) []string {
+	res := make([]string, 0)
+	for _, v := range splitSQLTopLevel(strings.TrimSuffix(strings.TrimPrefix(group, "("), ")")) {
+		tokens := tokenizeSQL(v)
+		if len(tokens) == 0 {
+			continue
+		}
+		name := tokens[0]
+		if i := strings.Index(name, "("); 0 < i && !strings.HasPrefix(name, "`") {
+			name = name[:i]
+		}
+		if strings.HasPrefix(name, "`") {
+			name = name[:strings.LastIndex(name, "`")+1]
+		}
+		res = append(res, unquoteIdentifier(name))
+	}
+	return res
+}
+
+func isKeyword(tokens []string, i int, keyword string) bool {
+	return i < len(tokens) && strings.ToUpper(tokens[i]) == keyword
+}
+
+func unquoteIdentifier(s string) string {
+	if 2 <= len(s) && s[0] == '`' && s[len(s)-1] == '`' {
+		return strings.Replace(s[1:len(s)-1], "``", "`", -1)
+	}
+	return s
+}
+
+func unquoteSQLString(s string) string {
+	if 2 <= len(s) && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		quote := string(s[0])
+		s = s[1 : len(s)-1]
+		s = strings.Replace(s, quote+quote, quote, -1)
+		s = strings.Replace(s, "\\"+quote, quote, -1)
+		return s
+	}
+	return s
+}
+
+/**
+文を;で分割する
+文字列, 識別子内の;と、コメント(--, #, ブロックコメント)は除く
+*/
+func splitSQLStatements(sql string) []string {
+	res := make([]string, 0)
+	buf := make([]byte, 0)
+	for i := 0; i < len(sql); i++ {
+		ch := sql[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			end := skipSQLQuoted(sql, i)
+			buf = append(buf, sql[i:end]...)
+			i = end - 1
+		case ch == '-' && strings.HasPrefix(sql[i:], "--") && (i+2 == len(sql) || sql[i+2] == ' ' || sql[i+2] == '\t' || sql[i+2] == '\n' || sql[i+2] == '\r'), ch == '#':
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+			buf = append(buf, '\n')
+		case ch == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end == -1 {
+				i = len(sql)
+			} else {
+				i += end + 3
+			}
+			buf = append(buf, ' ')
+		case ch == ';':
+			if s := strings.TrimSpace(string(buf)); s != "" {
+				res = append(res, s)
+			}
+			buf = buf[:0]
+		default:
+			buf = append(buf, ch)
+		}
+	}
+	if s := strings.TrimSpace(string(buf)); s != "" {
+		res = append(res, s)
+	}
+	return res
+}
+
+// 引用符で始まる文字列/識別子の終端の次の位置
+func skipSQLQuoted(sql string, start int) int {
+	quote := sql[start]
+	for i := start + 1; i < len(sql); i++ {
+		if sql[i] == '\\' && quote != '`' {
+			i++
+			continue
+		}
+		if sql[i] == quote {
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// 括弧の対応の終端の次の位置
+func skipSQLGroup(sql string, start int) int {
+	depth := 0
+	for i := start; i < len(sql); i++ {
+		switch sql[i] {
+		case '\'', '"', '`':
+			i = skipSQLQuoted(sql, i) - 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(sql)
+}
+
+// 括弧, 文字列の外のカンマで分割する
+func splitSQLTopLevel(sql string) []string {
+	res := make([]string, 0)
+	start := 0
+	for i := 0; i < len(sql); i++ {
+		switch sql[i] {
+		case '\'', '"', '`':
+			i = skipSQLQuoted(sql, i) - 1
+		case '(':
+			i = skipSQLGroup(sql, i) - 1
+		case ',':
+			res = append(res, strings.TrimSpace(sql[start:i]))
+			start = i + 1
+		}
+	}
+	if s := strings.TrimSpace(sql[start:]); s != "" {
+		res = append(res, s)
+	}
+	return res
+}
+
+/**
+単語, `識別子`, '文字列', (括弧), =, カンマに分割する
+直後に続く括弧/文字列は単語に含める(varchar(64), enum('a','b'), b'0')
+*/
+func tokenizeSQL(sql string) []string {
+	res := make([]string, 0)
+	for i := 0; i < len(sql); {
+		ch := sql[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '=' || ch == ',':
+			res = append(res, string(ch))
+			i++
+		case ch == '\'' || ch == '"' || ch == '`':
+			end := skipSQLQuoted(sql, i)
+			res = append(res, sql[i:end])
+			i = end
+		case ch == '(':
+			end := skipSQLGroup(sql, i)
+			res = append(res, sql[i:end])
+			i = end
+		default:
+			start := i
+			for i < len(sql) && !strings.ContainsRune(" \t\n\r=,`", rune(sql[i])) {
+				if sql[i] == '(' {
+					i = skipSQLGroup(sql, i)
+					continue
+				}
+				if sql[i] == '\'' || sql[i] == '"' {
+					i = skipSQLQuoted(sql, i)
+					continue
+				}
+				i++
+			}
+			res = append(res, sql[start:i])
+		}
+	}
+	return res
+}
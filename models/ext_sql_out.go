@@ -39,6 +39,19 @@ func (this Models) ToCreateSQL(fk bool, jsonComment bool) string {
 }
 
 func (this Table) ToCreateSQL(fk bool, jsonComment bool) string {
+	refColumns := make([]*Column, 0)
+	if fk {
+		for _, c := range this.Columns {
+			if c.Reference != "" {
+				refColumns = append(refColumns, c)
+			}
+		}
+	}
+	return this.ToCreateSQLWithRefs(jsonComment, refColumns)
+}
+
+// 指定カラムの外部キーのみを付与したcreate table文
+func (this Table) ToCreateSQLWithRefs(jsonComment bool, refColumns []*Column) string {
 	res := bytes.NewBuffer(nil)
 	res.WriteString("\n")
 	res.WriteString("-- -----------------------------------------------------\n")
@@ -78,14 +91,10 @@ func (this Table) ToCreateSQL(fk bool, jsonComment bool) string {
 	res.WriteString(";\n")
 
 	//Ref
-	if fk {
-		for _, c := range this.Columns {
-			//簡易FK
-			//ALTER TABLE `user_lock` ADD CONSTRAINT `fk_user_lock_user_id_user_id` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`);
-			if c.Reference != "" {
-				res.WriteString(c.ToFKAddSQL(this.Name.LowerSnake()))
-			}
-		}
+	for _, c := range refColumns {
+		//簡易FK
+		//ALTER TABLE `user_lock` ADD CONSTRAINT `fk_user_lock_user_id_user_id` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`);
+		res.WriteString(c.ToFKAddSQL(this.Name.LowerSnake()))
 	}
 	res.WriteString("\n")
 
@@ -117,6 +126,10 @@ func (this Table) ToAlterSQL() string {
 	return res.String()
 }
 
+func (this Table) ToAutoIncrementSQL() string {
+	return fmt.Sprintf("ALTER TABLE `%s` AUTO_INCREMENT=%d;\n", this.Name.LowerSnake(), this.AutoIncrement)
+}
+
 func (this Column) ToCreateSQL() string {
 	//  `login_bonus_id` INT NOT NULL COMMENT 'ログインボーナスのグルーピングID',
 	res := bytes.NewBuffer(nil)
@@ -132,9 +145,9 @@ func (this Column) ToCreateSQL() string {
 		res.WriteString(" DEFAULT ")
 		res.WriteString(normalizeDefault(&this))
 	}
-	if this.Extra != "" {
+	if extra := normalizeExtra(&this); extra != "" {
 		res.WriteString(" ")
-		res.WriteString(this.Extra)
+		res.WriteString(extra)
 	}
 	if this.Comment != "" {
 		res.WriteString(" COMMENT '")
@@ -192,6 +205,32 @@ func (this Column) ToModifySQL(tableName string, order string) string {
 	res.WriteString("ALTER TABLE `")
 	res.WriteString(tableName)
 	res.WriteString("`")
+	res.WriteString(this.toModifySpec(order))
+	res.WriteString(";\n")
+	return res.String()
+}
+
+/**
+複数カラムの並び順変更を1文で行う(テーブル再構築を1回にする)
+ordersはcolumnsと同じ順の"AFTER xxx" or "FIRST"で、先頭から順に適用される
+*/
+func ToMoveColumnsSQL(tableName string, columns []*Column, orders []string) string {
+	res := bytes.NewBuffer(nil)
+	res.WriteString("ALTER TABLE `")
+	res.WriteString(tableName)
+	res.WriteString("`")
+	for i, c := range columns {
+		if i != 0 {
+			res.WriteString(",")
+		}
+		res.WriteString(c.toModifySpec(orders[i]))
+	}
+	res.WriteString(";\n")
+	return res.String()
+}
+
+func (this Column) toModifySpec(order string) string {
+	res := bytes.NewBuffer(nil)
 	res.WriteString(" MODIFY COLUMN")
 	res.WriteString(this.ToCreateSQL())
 	// NOT NULLでDefaultがないdatetimeを同じ位置にMODIFYしようとするとエラー発生することがあるため、順序に変更がない場合は順序変更クエリを出力しない
@@ -200,7 +239,6 @@ func (this Column) ToModifySQL(tableName string, order string) string {
 		res.WriteString(order)
 		//res.WriteString(getColumnOrder(&this))
 	}
-	res.WriteString(";\n")
 	return res.String()
 }
 
@@ -209,6 +247,25 @@ func (this Column) ToRenameSQL(tableName string, to *Column) string {
 	res.WriteString("ALTER TABLE `")
 	res.WriteString(tableName)
 	res.WriteString("`")
+
+	// 8.0以降は定義を書かずにリネーム
+	if TargetVersion.SupportsRenameColumn() {
+		res.WriteString(" RENAME COLUMN `")
+		res.WriteString(this.Name.LowerSnake())
+		res.WriteString("` TO `")
+		res.WriteString(to.Name.LowerSnake())
+		res.WriteString("`;\n")
+		return res.String()
+	}
+	return this.ToChangeSQL(tableName, to)
+}
+
+// toの定義でリネームする(バージョンによらずCHANGE)
+func (this Column) ToChangeSQL(tableName string, to *Column) string {
+	res := bytes.NewBuffer(nil)
+	res.WriteString("ALTER TABLE `")
+	res.WriteString(tableName)
+	res.WriteString("`")
 	res.WriteString(" CHANGE")
 
 	res.WriteString(" ")
@@ -290,9 +347,9 @@ func (this Index) ToCreateSQL() string {
 	res.WriteString(strings.Join(tmp, ", "))
 	res.WriteString(")")
 
-	if this.Options != "" {
+	if options := this.normalizeOptions(); options != "" {
 		res.WriteString(" ")
-		res.WriteString(this.Options)
+		res.WriteString(options)
 	}
 
 	if this.Comment != "" {
@@ -323,3 +380,31 @@ func (this Index) ToDropSQL(tableName string) string {
 	res.WriteString("`;\n")
 	return res.String()
 }
+
+func (this Index) ToRenameSQL(tableName string, to *Index) string {
+	res := bytes.NewBuffer(nil)
+	res.WriteString("ALTER TABLE `")
+	res.WriteString(tableName)
+	res.WriteString("`")
+	res.WriteString(" RENAME INDEX `")
+	res.WriteString(this.Name)
+	res.WriteString("` TO `")
+	res.WriteString(to.Name)
+	res.WriteString("`;\n")
+	return res.String()
+}
+
+func (this Index) ToVisibilitySQL(tableName string) string {
+	res := bytes.NewBuffer(nil)
+	res.WriteString("ALTER TABLE `")
+	res.WriteString(tableName)
+	res.WriteString("`")
+	res.WriteString(" ALTER INDEX `")
+	res.WriteString(this.Name)
+	if this.IsInvisible() {
+		res.WriteString("` INVISIBLE;\n")
+	} else {
+		res.WriteString("` VISIBLE;\n")
+	}
+	return res.String()
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+/**
+MetaDataJsonに記述するデータ移行SQL
+テーブル/カラムの変更が適用される場合のみ、alter(pre, post), revert(revert_pre, revert_post)に出力される
+
+	{"migration": {"pre": "...", "post": "UPDATE ...", "revert_pre": "...", "revert_post": "..."}}
+*/
+type MigrationHook struct {
+	Pre        string `json:"pre"`
+	Post       string `json:"post"`
+	RevertPre  string `json:"revert_pre"`
+	RevertPost string `json:"revert_post"`
+}
+
+type metaData struct {
+	Migration  *MigrationHook `json:"migration"`
+	Deprecated bool           `json:"deprecated"`
+}
+
+// jsonでない場合はnil
+func parseMetaData(metaDataJson string) *metaData {
+	if strings.TrimSpace(metaDataJson) == "" {
+		return nil
+	}
+	m := &metaData{}
+	if err := json.Unmarshal([]byte(metaDataJson), m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// jsonでない, またはmigrationがない場合はnil
+func parseMigrationHook(metaDataJson string) *MigrationHook {
+	m := parseMetaData(metaDataJson)
+	if m == nil {
+		return nil
+	}
+	return m.Migration
+}
+
+func (this Table) GetMigrationHook() *MigrationHook {
+	return parseMigrationHook(this.MetaDataJson)
+}
+
+func (this Column) GetMigrationHook() *MigrationHook {
+	return parseMigrationHook(this.MetaDataJson)
+}
+
+// Deprecated, またはメタデータjsonの"deprecated"(Excel用)
+func (this Column) IsDeprecated() bool {
+	if this.Deprecated {
+		return true
+	}
+	m := parseMetaData(this.MetaDataJson)
+	return m != nil && m.Deprecated
+}
@@ -17,6 +17,9 @@ func checkError(err error) {
 
 type Models struct {
 	Tables []*Table
+
+	// 読み込み元データベースのバージョン(mysql dsnから読み込んだ場合のみ)
+	MysqlVersion string `json:"-" yaml:"-"`
 }
 
 func (a *Models) Len() int      { return len(a.Tables) }
@@ -51,6 +54,22 @@ type Table struct {
 	PrimaryKeys       []*Column    `json:"-" yaml:"-"`
 	References        []*Reference `json:"-" yaml:"-"`
 	InverseReferences []*Reference `json:"-" yaml:"-"`
+
+	// mysqlから読み込んだ場合のみ
+	Stats *TableStats `json:"-" yaml:"-"`
+	// AUTO_INCREMENTの値(テーブルオプション、mysqlまたはSQLのCREATE TABLEから読み込んだ場合のみ)
+	AutoIncrement int64 `json:"-" yaml:"-"`
+}
+
+// SHOW TABLE STATUSの統計情報
+type TableStats struct {
+	Rows        int64
+	DataLength  int64
+	IndexLength int64
+}
+
+func (this TableStats) TotalLength() int64 {
+	return this.DataLength + this.IndexLength
 }
 
 func (this Table) GetPrimaryKeyNum() int {
@@ -133,10 +152,52 @@ func (this *Table) RemoveIndex(removeIndexes ...*Index) {
 	this.Indexes = newList
 }
 
+/**
+カラムを除外する
+カラム並び(PreColumn), 主キーを再設定し、除外カラムを含むインデックスも除外する
+*/
+func (this *Table) RemoveColumn(removeColumns ...*Column) {
+	newList := make([]*Column, 0)
+	var pre *Column
+	for _, c1 := range this.Columns {
+		contain := false
+		for _, c2 := range removeColumns {
+			if c1 == c2 {
+				contain = true
+				break
+			}
+		}
+		if contain {
+			continue
+		}
+		c1.PreColumn = pre
+		pre = c1
+		newList = append(newList, c1)
+	}
+	this.Columns = newList
+	this.PrimaryKeys = this.getPrimaryKeys()
+
+	removeIndexes := make([]*Index, 0)
+	for _, in := range this.Indexes {
+		for _, c := range in.Columns {
+			if this.GetColumn(c.Name.LowerSnake()) == nil {
+				removeIndexes = append(removeIndexes, in)
+				break
+			}
+		}
+	}
+	this.RemoveIndex(removeIndexes...)
+}
+
 func (this Table) IsChange(other *Table) bool {
 	return this.Engine != other.Engine || this.Comment != other.Comment || this.DefaultCharset != other.DefaultCharset
 }
 
+// AUTO_INCREMENTの値が異なるか(otherに値がない場合は比較しない)
+func (this Table) IsChangeAutoIncrement(other *Table) bool {
+	return other.AutoIncrement != 0 && this.AutoIncrement != other.AutoIncrement
+}
+
 func (this Table) IsBinaryCollation() bool {
 	tmp := strings.Split(this.DefaultCollation, "_")
 	return tmp[len(tmp)-1] == "bin"
@@ -152,6 +213,7 @@ type Column struct {
 	Extra        string      `json:",omitempty" yaml:",omitempty"`
 	Reference    string      `json:",omitempty" yaml:",omitempty"`
 	Comment      string      `json:",omitempty" yaml:",omitempty"`
+	Deprecated   bool        `json:",omitempty" yaml:",omitempty"` // 廃止予定(diff --phasedのcontractで削除)
 	MetaDataJson string      `json:",omitempty" yaml:",omitempty"`
 	Descriptions []string    `json:",omitempty" yaml:",omitempty"`
 
@@ -389,34 +451,48 @@ const (
 	ColumnChangeType_NotNull
 	ColumnChangeType_Default
 	ColumnChangeType_Extra
+	ColumnChangeType_Order
 )
 
 /**
 カラム定義の変更を検査する。
 */
 func (this Column) IsChange(other *Column) ColumnChangeType {
+	changes := this.ChangeTypes(other)
+	if len(changes) == 0 {
+		return ColumnChangeType_Same
+	}
+	return changes[0]
+}
+
+/**
+カラム定義の変更をすべて検査する。
+変更がなければ空を返す。(並び順は検査しない)
+*/
+func (this Column) ChangeTypes(other *Column) []ColumnChangeType {
+	res := make([]ColumnChangeType, 0)
 	// 型の変更チェック
 	if !isSameMysqlType(this.Type, other.Type) {
-		return ColumnChangeType_Type
+		res = append(res, ColumnChangeType_Type)
 	}
 	// コメントの変更チェック
 	if this.Comment != other.Comment {
-		return ColumnChangeType_Comment
+		res = append(res, ColumnChangeType_Comment)
 	}
 	// NotNull制約の変更チェック
 	if this.NotNull != other.NotNull {
-		return ColumnChangeType_NotNull
+		res = append(res, ColumnChangeType_NotNull)
 	}
 	// Defaultの変更チェック
 	if normalizeDefault(&this) != normalizeDefault(other) {
 		//fmt.Println("default changed:", "'"+this.Default+"'", "'"+other.Default+"'")
-		return ColumnChangeType_Default
+		res = append(res, ColumnChangeType_Default)
 	}
 	// Extraの変更チェック
-	if this.Extra != other.Extra {
-		return ColumnChangeType_Extra
+	if normalizeExtra(&this) != normalizeExtra(other) {
+		res = append(res, ColumnChangeType_Extra)
 	}
-	return ColumnChangeType_Same
+	return res
 }
 
 /**
@@ -427,10 +503,25 @@ func isSameMysqlType(type1, type2 string) bool {
 	return normalizeMysqlType(type1) == normalizeMysqlType(type2)
 }
 
+var integerDisplayWidthPattern = regexp.MustCompile(`^(tinyint|smallint|mediumint|int|integer|bigint)\(\d+\)`)
+
 /**
 カラム型名を正規化する
+TargetVersionが8.0.19以降であれば整数型の表示幅を除去する(tinyint(1), zerofillは除く)
 */
 func normalizeMysqlType(t string) string {
+	if TargetVersion.OmitsIntegerDisplayWidth() {
+		switch t {
+		case "boolean", "bool":
+			return "tinyint(1)"
+		case "year(4)":
+			return "year"
+		}
+		if strings.HasPrefix(t, "tinyint(1)") || strings.Contains(t, "zerofill") {
+			return t
+		}
+		return integerDisplayWidthPattern.ReplaceAllString(t, "$1")
+	}
 
 	switch t {
 	case "bigint":
@@ -453,6 +544,26 @@ func normalizeMysqlType(t string) string {
 	return t
 }
 
+var (
+	invisiblePattern  = regexp.MustCompile(`(?i)\s*\bINVISIBLE\b`)
+	visibilityPattern = regexp.MustCompile(`(?i)\s*\b(IN)?VISIBLE\b`)
+)
+
+/**
+Extraを正規化する
+TargetVersionが不可視カラムに対応していなければINVISIBLEを除去する
+*/
+func normalizeExtra(c *Column) string {
+	if TargetVersion.SupportsInvisibleColumn() {
+		return c.Extra
+	}
+	return strings.TrimSpace(invisiblePattern.ReplaceAllString(c.Extra, ""))
+}
+
+func (this Column) IsInvisible() bool {
+	return invisiblePattern.MatchString(this.Extra)
+}
+
 func getColumnOrder(c *Column) string {
 	if c.PreColumn != nil {
 		return " AFTER `" + c.PreColumn.Name.LowerSnake() + "`"
@@ -492,6 +603,37 @@ type Index struct {
 	Columns []*Column `json:"-" yaml:"-"`
 }
 
+func (this Index) IsInvisible() bool {
+	return invisiblePattern.MatchString(this.Options)
+}
+
+/**
+Optionsを正規化する
+TargetVersionが不可視インデックスに対応していなければINVISIBLEを除去する
+*/
+func (this Index) normalizeOptions() string {
+	if TargetVersion.SupportsInvisibleIndex() {
+		return this.Options
+	}
+	return strings.TrimSpace(invisiblePattern.ReplaceAllString(this.Options, ""))
+}
+
+// 可視性以外の定義が同一か
+func (this Index) IsSameIgnoringVisibility(other *Index) bool {
+	a := this
+	b := *other
+	a.Options = strings.TrimSpace(visibilityPattern.ReplaceAllString(a.Options, ""))
+	b.Options = strings.TrimSpace(visibilityPattern.ReplaceAllString(b.Options, ""))
+	return a.ToCreateSQL() == b.ToCreateSQL()
+}
+
+// 名前以外の定義が同一か
+func (this Index) IsSameIgnoringName(other *Index) bool {
+	a := this
+	a.Name = other.Name
+	return a.ToCreateSQL() == other.ToCreateSQL()
+}
+
 func (this Index) IsContainColumnName(name string) bool {
 	for _, n := range this.ColumnNames {
 		if n == name {
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// 出力対象のMySQLバージョン
+type MysqlVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// バージョン指定がなく検出もできない場合は5.7互換で出力する
+var DefaultMysqlVersion = MysqlVersion{Major: 5, Minor: 7}
+
+// 型の正規化、DDLの出力に使用するバージョン
+var TargetVersion = DefaultMysqlVersion
+
+var mysqlVersionPattern = regexp.MustCompile(`^(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+
+/**
+バージョン文字列を解析する
+"8.0.32-log", "5.7", "8" などを受け付ける
+*/
+func ParseMysqlVersion(v string) MysqlVersion {
+	m := mysqlVersionPattern.FindStringSubmatch(v)
+	if m == nil {
+		panic(fmt.Sprint("invalid mysql version:", v))
+	}
+	res := MysqlVersion{}
+	res.Major, _ = strconv.Atoi(m[1])
+	res.Minor, _ = strconv.Atoi(m[2])
+	res.Patch, _ = strconv.Atoi(m[3])
+	return res
+}
+
+func (this MysqlVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", this.Major, this.Minor, this.Patch)
+}
+
+func (this MysqlVersion) AtLeast(major, minor, patch int) bool {
+	if this.Major != major {
+		return major < this.Major
+	}
+	if this.Minor != minor {
+		return minor < this.Minor
+	}
+	return patch <= this.Patch
+}
+
+// 8.0.19から整数型の表示幅が出力されない
+func (this MysqlVersion) OmitsIntegerDisplayWidth() bool {
+	return this.AtLeast(8, 0, 19)
+}
+
+func (this MysqlVersion) SupportsRenameColumn() bool {
+	return this.AtLeast(8, 0, 0)
+}
+
+func (this MysqlVersion) SupportsRenameIndex() bool {
+	return this.AtLeast(5, 7, 0)
+}
+
+// 8.0.12から末尾へのカラム追加、8.0.29から任意位置へのカラム追加がINSTANT
+func (this MysqlVersion) SupportsInstantAddColumn(trailing bool) bool {
+	if this.AtLeast(8, 0, 29) {
+		return true
+	}
+	return trailing && this.AtLeast(8, 0, 12)
+}
+
+func (this MysqlVersion) SupportsInvisibleColumn() bool {
+	return this.AtLeast(8, 0, 23)
+}
+
+func (this MysqlVersion) SupportsInvisibleIndex() bool {
+	return this.AtLeast(8, 0, 0)
+}
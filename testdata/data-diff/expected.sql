@@ -0,0 +1,58 @@
+warning: column only in new data is not compared: user.note
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+DELETE FROM `user_tag` WHERE `user_id` = 3 AND `tag` = 'a';
+DELETE FROM `item` WHERE `id` = 11;
+DELETE FROM `user` WHERE `id` = 3;
+UPDATE `user` SET `name` = 'bob\'s' WHERE `id` = 2;
+INSERT INTO `user` (`id`, `name`, `note`) 
+VALUES 
+(4,'dave',null);
+INSERT INTO `item` (`id`, `user_id`) 
+VALUES 
+(12,4);
+UPDATE `user_tag` SET `weight` = 3 WHERE `user_id` = 1 AND `tag` = 'b';
+INSERT INTO `user_tag` (`user_id`, `tag`, `weight`) 
+VALUES 
+(4,'a',null);
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
+
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+DELETE FROM `user_tag` WHERE `user_id` = 4 AND `tag` = 'a';
+DELETE FROM `item` WHERE `id` = 12;
+DELETE FROM `user` WHERE `id` = 4;
+UPDATE `user` SET `name` = 'bob' WHERE `id` = 2;
+INSERT INTO `user` (`id`, `name`) 
+VALUES 
+(3,'carol');
+INSERT INTO `item` (`id`, `user_id`) 
+VALUES 
+(11,3);
+UPDATE `user_tag` SET `weight` = 2 WHERE `user_id` = 1 AND `tag` = 'b';
+INSERT INTO `user_tag` (`user_id`, `tag`, `weight`) 
+VALUES 
+(3,'a',null);
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
@@ -0,0 +1,21 @@
+#!/bin/bash
+# data-diffの回帰テスト
+# old.json から new.json へのDML(defines.json の主キーで突き合わせ)を expected.sql と比較する
+# UPDATE=1 で expected.sql を再生成
+set -u
+cd "$(dirname "$0")"
+BIN=$(mktemp)
+trap 'rm -f "$BIN"' EXIT
+(cd ../.. && go build -o "$BIN" .) || exit 2
+
+actual=$("$BIN" data-diff --old old.json --defines defines.json new.json 2>&1)
+if [ "${UPDATE:-}" = "1" ]; then
+	echo "$actual" > expected.sql
+	echo "update data-diff"
+	exit 0
+fi
+if ! diff -u expected.sql <(echo "$actual"); then
+	echo "FAIL data-diff"
+	exit 1
+fi
+echo "ok   data-diff"
@@ -0,0 +1,21 @@
+#!/bin/bash
+# data-lintの回帰テスト
+# master.json, extra.json を defines.json で検査した結果を expected.txt と比較する
+# UPDATE=1 で expected.txt を再生成
+set -u
+cd "$(dirname "$0")"
+BIN=$(mktemp)
+trap 'rm -f "$BIN"' EXIT
+(cd ../.. && go build -o "$BIN" .) || exit 2
+
+actual=$("$BIN" data-lint --defines defines.json master.json extra.json 2>&1)
+if [ "${UPDATE:-}" = "1" ]; then
+	echo "$actual" > expected.txt
+	echo "update data-lint"
+	exit 0
+fi
+if ! diff -u expected.txt <(echo "$actual"); then
+	echo "FAIL data-lint"
+	exit 1
+fi
+echo "ok   data-lint"
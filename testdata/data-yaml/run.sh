@@ -0,0 +1,42 @@
+#!/bin/bash
+# yaml, testfixtures入出力の回帰テスト
+# input.json を yaml(keyed, positional), testfixtures に出力した結果を expected.txt と比較し、
+# それぞれを読み込んだ json が input.json と同じ値になることを確認する(データのないテーブルは読み込まない)
+# UPDATE=1 で expected.txt を再生成
+set -u
+cd "$(dirname "$0")"
+BIN=$(mktemp)
+TMP=$(mktemp -d)
+trap 'rm -rf "$BIN" "$TMP"' EXIT
+(cd ../.. && go build -o "$BIN" .) || exit 2
+
+"$BIN" data -f json --ignore-tables empty input.json > "$TMP/input.json" 2>&1
+"$BIN" data -f yaml input.json > "$TMP/keyed.yaml" 2>&1
+"$BIN" data -f yaml --yaml-layout positional input.json > "$TMP/positional.yaml" 2>&1
+"$BIN" data -f testfixtures -o "$TMP/fixtures" input.json > /dev/null 2>&1
+
+actual=$(
+	for f in keyed.yaml positional.yaml fixtures/empty.yml fixtures/item.yml fixtures/user.yml; do
+		echo "== $f"
+		cat "$TMP/$f"
+	done
+	for f in keyed.yaml positional.yaml fixtures; do
+		"$BIN" data -f json "$TMP/$f" > "$TMP/roundtrip.json" 2>&1
+		if cmp -s "$TMP/input.json" "$TMP/roundtrip.json"; then
+			echo "== roundtrip $f: same"
+		else
+			echo "== roundtrip $f: differ"
+			diff "$TMP/input.json" "$TMP/roundtrip.json"
+		fi
+	done
+)
+if [ "${UPDATE:-}" = "1" ]; then
+	echo "$actual" > expected.txt
+	echo "update data-yaml"
+	exit 0
+fi
+if ! diff -u expected.txt <(echo "$actual"); then
+	echo "FAIL data-yaml"
+	exit 1
+fi
+echo "ok   data-yaml"
@@ -0,0 +1,27 @@
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+
+-- -----------------------------------------------------
+-- Table `a_log`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `a_log` (
+ `id` bigint(20) NOT NULL,
+ `item_id` bigint(20) NOT NULL,
+  PRIMARY KEY (`id`))
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8mb4;
+
+ALTER TABLE `user` ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='users!';
+ALTER TABLE `user` RENAME INDEX `name_idx` TO `name_idx2`;
+ALTER TABLE `user` MODIFY COLUMN `age` bigint(20) DEFAULT 0 COMMENT 'age2';
+ALTER TABLE `user` MODIFY COLUMN `name` varchar(64) NOT NULL COMMENT 'name2';
+ALTER TABLE `user` MODIFY COLUMN `name` varchar(64) NOT NULL COMMENT 'name2' AFTER age;
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
@@ -0,0 +1,35 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+ALTER TABLE `item` CHANGE `a` `x` int(11);
+ALTER TABLE `item` MODIFY COLUMN `d` int(11) FIRST, MODIFY COLUMN `b` int(11) AFTER c;
+ALTER TABLE `user` MODIFY COLUMN `f` int(11) AFTER id;
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
+
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+ALTER TABLE `item` CHANGE `x` `a` int(11);
+ALTER TABLE `item` MODIFY COLUMN `c` int(11) AFTER b, MODIFY COLUMN `d` int(11) AFTER c;
+ALTER TABLE `user` MODIFY COLUMN `f` int(11) AFTER e;
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
@@ -0,0 +1,29 @@
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+-- ALGORITHM=COPY, LOCK=SHARED (rebuild): change charset
+ALTER TABLE `item` ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='', ALGORITHM=COPY, LOCK=SHARED;
+-- ALGORITHM=INPLACE, LOCK=NONE (rebuild): change comment (rebuild by ENGINE)
+ALTER TABLE `user` ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='users', ALGORITHM=INPLACE, LOCK=NONE;
+-- ALGORITHM=INSTANT: add column
+ALTER TABLE `order` ADD COLUMN `memo` varchar(255) AFTER `created_at`, ALGORITHM=INSTANT;
+-- ALGORITHM=INSTANT: change index visibility
+ALTER TABLE `order` ALTER INDEX `price_idx` INVISIBLE, ALGORITHM=INSTANT;
+-- ALGORITHM=INPLACE, LOCK=NONE: drop index
+ALTER TABLE `order` DROP INDEX `created_idx`, ALGORITHM=INPLACE, LOCK=NONE;
+-- ALGORITHM=INPLACE, LOCK=SHARED: add fulltext index
+ALTER TABLE `order` ADD  FULLTEXT INDEX `memo_idx` (`memo`), ALGORITHM=INPLACE, LOCK=SHARED;
+-- ALGORITHM=COPY, LOCK=SHARED (rebuild): change column type
+ALTER TABLE `order` MODIFY COLUMN `status` bigint NOT NULL, ALGORITHM=COPY, LOCK=SHARED;
+-- ALGORITHM=INSTANT: change column default/comment
+ALTER TABLE `order` MODIFY COLUMN `price` int NOT NULL COMMENT 'price', ALGORITHM=INSTANT;
+-- ALGORITHM=INPLACE, LOCK=NONE (rebuild): change column nullability
+ALTER TABLE `order` MODIFY COLUMN `created_at` datetime, ALGORITHM=INPLACE, LOCK=NONE;
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
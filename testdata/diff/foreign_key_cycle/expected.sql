@@ -0,0 +1,51 @@
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+
+-- -----------------------------------------------------
+-- Table `m_group`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `m_group` (
+ `id` bigint(20) NOT NULL,
+ `owner_id` bigint(20),
+  PRIMARY KEY (`id`))
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8mb4;
+
+
+-- -----------------------------------------------------
+-- Table `z_user`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `z_user` (
+ `id` bigint(20) NOT NULL,
+ `group_id` bigint(20),
+  PRIMARY KEY (`id`))
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8mb4;
+
+
+-- -----------------------------------------------------
+-- Table `a_post`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `a_post` (
+ `id` bigint(20) NOT NULL,
+ `user_id` bigint(20) NOT NULL,
+ `parent_id` bigint(20),
+  PRIMARY KEY (`id`))
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8mb4;
+ALTER TABLE `a_post` ADD CONSTRAINT `ref_a_post_user_id_z_user_id` FOREIGN KEY (`user_id`) REFERENCES `z_user` (`id`);
+
+-- circular foreign key reference: `m_group`, `z_user`
+ALTER TABLE `a_post` ADD CONSTRAINT `ref_a_post_parent_id_a_post_id` FOREIGN KEY (`parent_id`) REFERENCES `a_post` (`id`);
+ALTER TABLE `m_group` ADD CONSTRAINT `ref_m_group_owner_id_z_user_id` FOREIGN KEY (`owner_id`) REFERENCES `z_user` (`id`);
+ALTER TABLE `z_user` ADD CONSTRAINT `ref_z_user_group_id_m_group_id` FOREIGN KEY (`group_id`) REFERENCES `m_group` (`id`);
+
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
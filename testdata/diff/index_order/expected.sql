@@ -0,0 +1,30 @@
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+ALTER TABLE `order` DROP FOREIGN KEY `ref_order_user_id_user_id`;
+ALTER TABLE `order` DROP FOREIGN KEY `ref_order_item_id_item_id`;
+ALTER TABLE `order` DROP FOREIGN KEY `ref_order_shop_id_shop_id`;
+ALTER TABLE `order` DROP INDEX `user_idx`;
+ALTER TABLE `order` DROP INDEX `item_idx`;
+ALTER TABLE `order` DROP INDEX `shop_idx`;
+ALTER TABLE `order` DROP INDEX `created_idx`;
+ALTER TABLE `order` DROP INDEX `status_idx`;
+ALTER TABLE `order` DROP INDEX `price_idx`;
+ALTER TABLE `order` ADD  INDEX `user_idx` (`user_id`, `status`);
+ALTER TABLE `order` ADD  INDEX `item_idx` (`item_id`, `created_at`);
+ALTER TABLE `order` ADD  INDEX `shop_idx` (`shop_id`);
+ALTER TABLE `order` ADD  UNIQUE INDEX `created_idx` (`created_at`);
+ALTER TABLE `order` ADD  INDEX `status_price_idx` (`status`, `price`);
+ALTER TABLE `order` ADD  INDEX `user_price_idx` (`user_id`, `price`);
+ALTER TABLE `order` ADD  INDEX `item_status_idx` (`item_id`, `status`);
+ALTER TABLE `order` ADD CONSTRAINT `ref_order_user_id_user_id` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`);
+ALTER TABLE `order` ADD CONSTRAINT `ref_order_item_id_item_id` FOREIGN KEY (`item_id`) REFERENCES `item` (`id`);
+ALTER TABLE `order` ADD CONSTRAINT `ref_order_shop_id_shop_id` FOREIGN KEY (`shop_id`) REFERENCES `shop` (`id`);
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
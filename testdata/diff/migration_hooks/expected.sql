@@ -0,0 +1,43 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+ALTER TABLE `user` ADD COLUMN `status` int(11) NOT NULL AFTER `legacy_flag`;
+-- post-migration: user.status
+UPDATE `user` SET `status` = IF(`legacy_flag` = 1, 2, 1);
+-- pre-migration: item
+DELETE FROM `item` WHERE `price` < 0;
+ALTER TABLE `item` MODIFY COLUMN `price` bigint(20) NOT NULL;
+-- post-migration: item.price
+UPDATE `item` SET `price` = `price` * 100;
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
+
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+-- pre-revert: user.status
+UPDATE `user` SET `legacy_flag` = `status` = 2;
+ALTER TABLE `user` DROP COLUMN `status`;
+-- pre-revert: item.price
+UPDATE `item` SET `price` = `price` DIV 100;
+ALTER TABLE `item` MODIFY COLUMN `price` int(11) NOT NULL;
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
@@ -0,0 +1,15 @@
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+ALTER TABLE `user` RENAME COLUMN `name` TO `nick`;
+ALTER TABLE `user` ADD COLUMN `memo` text INVISIBLE AFTER `age`, ALGORITHM=INSTANT;
+ALTER TABLE `user` DROP INDEX `name_idx`;
+ALTER TABLE `user` ADD  INDEX `name_idx` (`nick`) INVISIBLE;
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
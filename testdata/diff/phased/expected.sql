@@ -0,0 +1,103 @@
+-- migration: expand
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+-- pre-migration: user
+DELETE FROM `user` WHERE `id` = 0;
+ALTER TABLE `user` ADD COLUMN `display_name` varchar(64) COMMENT 'name' AFTER `user_name`;
+ALTER TABLE `user` ADD COLUMN `age_new` bigint(20) COMMENT 'age' AFTER `age`;
+ALTER TABLE `user` ADD COLUMN `email` varchar(255) AFTER `legacy_code`;
+UPDATE `user` SET `display_name` = `user_name`;
+UPDATE `user` SET `age_new` = `age`;
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
+
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+ALTER TABLE `user` DROP COLUMN `display_name`;
+ALTER TABLE `user` DROP COLUMN `age_new`;
+ALTER TABLE `user` DROP COLUMN `email`;
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
+
+
+-- migration: contract
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+UPDATE `user` SET `display_name` = `user_name`;
+UPDATE `user` SET `age_new` = `age`;
+ALTER TABLE `user` DROP COLUMN `age`;
+ALTER TABLE `user` CHANGE `age_new` `age` bigint(20) COMMENT 'age';
+DROP TABLE IF EXISTS `old_log`;
+ALTER TABLE `user` DROP INDEX `legacy_idx`;
+ALTER TABLE `user` DROP COLUMN `user_name`;
+ALTER TABLE `user` DROP COLUMN `nickname`;
+ALTER TABLE `user` DROP COLUMN `legacy_code`;
+ALTER TABLE `user` MODIFY COLUMN `display_name` varchar(64) NOT NULL COMMENT 'name';
+-- post-migration: user
+ANALYZE TABLE `user`;
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
+
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+
+-- -----------------------------------------------------
+-- Table `old_log`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `old_log` (
+ `id` bigint(20) NOT NULL,
+  PRIMARY KEY (`id`))
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8mb4;
+
+ALTER TABLE `user` ADD COLUMN `user_name` varchar(64) NOT NULL COMMENT 'name' AFTER `id`;
+ALTER TABLE `user` ADD COLUMN `nickname` varchar(32) AFTER `age`;
+ALTER TABLE `user` ADD COLUMN `legacy_code` varchar(16) AFTER `nickname`;
+ALTER TABLE `user` ADD  INDEX `legacy_idx` (`legacy_code`);
+ALTER TABLE `user` MODIFY COLUMN `display_name` varchar(64) COMMENT 'name';
+UPDATE `user` SET `user_name` = `display_name`;
+ALTER TABLE `user` CHANGE `age` `age_new` bigint(20) COMMENT 'age';
+ALTER TABLE `user` ADD COLUMN `age` int(11) COMMENT 'age' AFTER `display_name`;
+UPDATE `user` SET `age` = `age_new`;
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
@@ -0,0 +1,94 @@
+-- migration: expand
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+ALTER TABLE `order` ADD COLUMN `amount_new` bigint AFTER `amount`, ALGORITHM=INSTANT;
+ALTER TABLE `order` ADD COLUMN `updated_at_new` datetime DEFAULT CURRENT_TIMESTAMP AFTER `updated_at`, ALGORITHM=INSTANT;
+ALTER TABLE `order` ADD COLUMN `memo` varchar(64) AFTER `note`, ALGORITHM=INSTANT;
+UPDATE `order` SET `amount_new` = `amount`;
+UPDATE `order` SET `updated_at_new` = `updated_at`;
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
+
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+ALTER TABLE `order` DROP COLUMN `amount_new`;
+ALTER TABLE `order` DROP COLUMN `updated_at_new`;
+ALTER TABLE `order` DROP COLUMN `memo`;
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
+
+
+-- migration: contract
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+UPDATE `order` SET `amount_new` = `amount`;
+UPDATE `order` SET `updated_at_new` = `updated_at`;
+ALTER TABLE `order` DROP INDEX `user_amount_idx`;
+ALTER TABLE `order` DROP COLUMN `amount`;
+ALTER TABLE `order` CHANGE `amount_new` `amount` bigint NOT NULL;
+ALTER TABLE `order` ADD  INDEX `user_amount_idx` (`user_code`, `amount`);
+ALTER TABLE `order` DROP INDEX `updated_idx`;
+ALTER TABLE `order` DROP COLUMN `updated_at`;
+ALTER TABLE `order` CHANGE `updated_at_new` `updated_at` datetime DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;
+ALTER TABLE `order` ADD  INDEX `updated_idx` (`updated_at`);
+ALTER TABLE `order` DROP COLUMN `note`;
+ALTER TABLE `order` MODIFY COLUMN `memo` varchar(64) NOT NULL;
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
+
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+BEGIN;
+SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;
+SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;
+SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='STRICT_TRANS_TABLES,STRICT_ALL_TABLES,NO_ENGINE_SUBSTITUTION,ALLOW_INVALID_DATES';
+
+ALTER TABLE `order` ADD COLUMN `note` varchar(64) AFTER `updated_at`, ALGORITHM=INSTANT;
+ALTER TABLE `order` MODIFY COLUMN `memo` varchar(64);
+ALTER TABLE `order` DROP INDEX `user_amount_idx`;
+ALTER TABLE `order` CHANGE `amount` `amount_new` bigint;
+ALTER TABLE `order` ADD COLUMN `amount` int NOT NULL AFTER `user_code`;
+UPDATE `order` SET `amount` = `amount_new`;
+ALTER TABLE `order` ADD  INDEX `user_amount_idx` (`user_code`, `amount`);
+ALTER TABLE `order` DROP INDEX `updated_idx`;
+ALTER TABLE `order` CHANGE `updated_at` `updated_at_new` datetime DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE `order` ADD COLUMN `updated_at` timestamp DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP AFTER `amount_new`;
+UPDATE `order` SET `updated_at` = `updated_at_new`;
+ALTER TABLE `order` ADD  INDEX `updated_idx` (`updated_at`);
+
+SET SQL_MODE=@OLD_SQL_MODE;
+SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;
+SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;
+COMMIT;
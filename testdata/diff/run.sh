@@ -0,0 +1,48 @@
+#!/bin/bash
+# diffの回帰テスト
+# testdata/diff/<case>/{old.json,new.json,args} の差分出力を expected.sql と比較する
+# (-f markdown, htmlのレポートは expected.md, expected.html)
+# UPDATE=1 で expected.sql を再生成
+set -u
+cd "$(dirname "$0")"
+BIN=$(mktemp)
+trap 'rm -f "$BIN"' EXIT
+(cd ../.. && go build -o "$BIN" .) || exit 2
+
+# 出力順の揺れを検出するため複数回実行する
+RUNS=${RUNS:-5}
+failed=0
+for dir in */; do
+	name=${dir%/}
+	args=$(cat "$name/args")
+	case "$args" in
+	*"-f markdown"*) expected="$name/expected.md" ;;
+	*"-f html"*) expected="$name/expected.html" ;;
+	*) expected="$name/expected.sql" ;;
+	esac
+	if ! actual=$(cd "$name" && "$BIN" diff $args --old old.json new.json 2>/dev/null); then
+		echo "FAIL $name: diff exited with an error"
+		failed=1
+		continue
+	fi
+	for i in $(seq 2 "$RUNS"); do
+		again=$(cd "$name" && "$BIN" diff $args --old old.json new.json 2>/dev/null)
+		if [ "$actual" != "$again" ]; then
+			echo "FAIL $name: output is not deterministic"
+			failed=1
+			continue 2
+		fi
+	done
+	if [ "${UPDATE:-}" = "1" ]; then
+		printf '%s\n' "$actual" > "$expected"
+		echo "update $name"
+		continue
+	fi
+	if ! diff -u "$expected" <(printf '%s\n' "$actual"); then
+		echo "FAIL $name"
+		failed=1
+		continue
+	fi
+	echo "ok   $name"
+done
+exit $failed
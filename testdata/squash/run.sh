@@ -0,0 +1,41 @@
+#!/bin/bash
+# squashの回帰テスト
+# testdata/squash/migrations を一時ディレクトリにコピーしてsquashし、ベースラインを expected.sql と比較する
+# UPDATE=1 で expected.sql を再生成
+set -u
+cd "$(dirname "$0")"
+BIN=$(mktemp)
+WORK=$(mktemp -d)
+trap 'rm -rf "$BIN" "$WORK"' EXIT
+(cd ../.. && go build -o "$BIN" .) || exit 2
+
+UNTIL=20240201000000
+cp migrations/*.sql "$WORK/"
+if ! "$BIN" squash --until "$UNTIL" "$WORK" >/dev/null 2>&1; then
+	echo "FAIL squash: exited with an error"
+	exit 1
+fi
+actual="$WORK/${UNTIL}_goose_baseline.sql"
+if [ "${UPDATE:-}" = "1" ]; then
+	cp "$actual" expected.sql
+	echo "update squash"
+	exit 0
+fi
+
+failed=0
+if ! diff -u expected.sql "$actual"; then
+	echo "FAIL squash: baseline"
+	failed=1
+fi
+remains=$(cd "$WORK" && ls *.sql | tr '\n' ' ')
+if [ "$remains" != "${UNTIL}_goose_baseline.sql 20240301000000_goose.sql " ]; then
+	echo "FAIL squash: remaining migrations: $remains"
+	failed=1
+fi
+archived=$(cd "$WORK/archive" && ls | tr '\n' ' ')
+if [ "$archived" != "20240101000000_goose.sql 20240201000000_goose.sql " ]; then
+	echo "FAIL squash: archived migrations: $archived"
+	failed=1
+fi
+[ $failed = 0 ] && echo "ok   squash"
+exit $failed